@@ -0,0 +1,191 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command checks that every file referenced by the
+// compose files of a service exists and is decrypted, and
+// that every encrypted secret is referenced. It exits with
+// a non-zero code when there is any issue, so that it can
+// be used in a CI pipeline or before starting a service
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that the secrets referenced by the compose files exist and are decrypted",
+	Long: `Check the files referenced by the compose files of a service,
+	or of every service when no service is specified.
+
+	The env_file of every service, the file of the top-level
+	secrets and configs, and the bind-mounted files are checked
+	against the encrypted secrets of the service:
+
+	  Not decrypted  the encrypted source exists, but it is not decrypted
+	  Missing        neither the file nor an encrypted source exists
+	  Not encrypted  the file is git ignored and has no encrypted source
+
+	An encrypted secret that no compose file references is
+	reported as orphaned.
+
+	The variables interpolated in the compose files, such as
+	${VAR}, ${VAR:?err} and ${VAR:-default}, are compared with
+	the keys of the .env next to them. The keys are read from
+	the decrypted .env, or from the encrypted .env.enc as sops
+	leaves the key names in plaintext. A variable without a
+	default that is not in the .env is reported as missing, the
+	defaulted variables and the unused keys are only listed.
+
+	The command exits with 1 when any issue is found.`,
+	Example: `  Check the compose references:
+
+  # every service in the repository
+  composectl check
+
+  # by service name (as per 'composectl list')
+  composectl check -n gitea
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			os.Exit(1)
+		}
+
+		var serviceNames []string
+		if name != "" || sequence > 0 {
+			serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+
+			if serviceLists == nil && err == nil {
+				os.Exit(1)
+			}
+			serviceNames = []string{name}
+		} else {
+			serviceNames, err = services.ListAllService(repoRoot)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		var failedServices int = 0
+		for _, serviceName := range serviceNames {
+			report, err := services.CheckServiceReferences(repoRoot, serviceName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", serviceName, err)
+				failedServices++
+				continue
+			}
+
+			variableReports, err := services.CheckServiceVariables(repoRoot, serviceName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", serviceName, err)
+				failedServices++
+				continue
+			}
+
+			var hasMissingVariables bool = false
+			var hasVariableNotes bool = false
+			for _, variableReport := range variableReports {
+				hasMissingVariables = hasMissingVariables || len(variableReport.Missing) > 0
+				hasVariableNotes = hasVariableNotes || len(variableReport.Defaulted) > 0 || len(variableReport.Unused) > 0
+			}
+
+			if !report.HasIssues() && !hasMissingVariables && !hasVariableNotes {
+				continue
+			}
+			if report.HasIssues() || hasMissingVariables {
+				failedServices++
+			}
+
+			fmt.Printf("%s:\n", serviceName)
+			printReferenceIssues(report)
+			printVariableReports(variableReports)
+		}
+
+		if failedServices > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d of %d services have issues\n", failedServices, len(serviceNames))
+			os.Exit(1)
+		}
+
+		fmt.Printf("All %d services are OK\n", len(serviceNames))
+	},
+}
+
+// printReferenceIssues prints the broken references and the orphaned
+// encrypted secrets of the report
+func printReferenceIssues(report *services.ReferenceReport) {
+	for _, result := range report.References {
+		if result.State == services.ReferenceOK {
+			continue
+		}
+		fmt.Printf("  %-14s %s (%s %s in %s)\n", services.GetReferenceStateString(result.State),
+			result.Reference.Path, result.Reference.Kind, result.Reference.Name, result.Reference.ComposeFile)
+	}
+	for _, orphaned := range report.Orphaned {
+		fmt.Printf("  %-14s %s (not referenced by any compose file)\n", "Orphaned", orphaned)
+	}
+}
+
+// printVariableReports prints the missing, defaulted and unused
+// variables of the reports
+func printVariableReports(reports []services.VariableReport) {
+	for _, report := range reports {
+		var from string = fmt.Sprintf("%s, keys from the %s file", report.EnvFile, report.KeysSource)
+		if report.KeysSource == "none" {
+			from = fmt.Sprintf("%s does not exist", report.EnvFile)
+		}
+
+		for _, variable := range report.Missing {
+			fmt.Printf("  %-14s ${%s} (%s)\n", "Missing var", variable.Name, from)
+		}
+		for _, variable := range report.Defaulted {
+			fmt.Printf("  %-14s ${%s} uses the default %q\n", "Defaulted var", variable.Name, variable.Default)
+		}
+		for _, key := range report.Unused {
+			fmt.Printf("  %-14s %s in %s is not used by %s\n", "Unused var", key, report.EnvFile,
+				strings.Join(report.ComposeFiles, ", "))
+		}
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().StringP("name", "n", "", "The name of the service (default to all services)")
+	checkCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service (default to all services)")
+}
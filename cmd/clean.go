@@ -0,0 +1,173 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/deps"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command removes the decrypted secrets of a service so
+// that no plaintext is left on disk after maintenance. Only the
+// decrypted files that are in sync with the encrypted version
+// are removed, and a running service is left alone unless forced.
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove the decrypted secrets of the specified service",
+	Long: `Remove the decrypted counterpart of every secret of a service,
+	or of every service with --all.
+
+	A decrypted file is only removed when its content is the same as
+	the encrypted version, so that edits which were never encrypted
+	are not lost. Use 'composectl diff' and 'composectl sync' to
+	resolve the other files first.
+
+	Services that are running are skipped unless --force is given,
+	as the containers may still need the decrypted files.`,
+	Example: `  Remove the decrypted secrets:
+
+  # by service name (as per 'composectl list')
+  composectl clean -n gitea
+
+  # every service, overwriting the file content before removing it
+  composectl clean --all --shred
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+
+		all, _ := cmd.Flags().GetBool("all")
+		shred, _ := cmd.Flags().GetBool("shred")
+		force, _ := cmd.Flags().GetBool("force")
+
+		if name == "" && sequence <= 0 && !all {
+			fmt.Fprintln(os.Stderr, "Either the service name or sequence must be specified correctly, or use --all!")
+			return
+		}
+
+		if err := checkSops(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		var canCheckDocker bool = true
+		if err := deps.CheckDockerDeps(config.DockerBuildxMajorVersion, config.DockerComposeMajorVersion); err != nil {
+			if !force {
+				fmt.Fprintf(os.Stderr, "Error: %v\nUnable to check whether the services are running, use --force to clean anyway\n", err)
+				return
+			}
+			canCheckDocker = false
+		}
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		var serviceNames []string
+		if all {
+			serviceNames, err = services.ListAllService(repoRoot)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+				return
+			}
+		} else {
+			serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				return
+			}
+
+			if serviceLists == nil && err == nil {
+				return
+			}
+			serviceNames = []string{name}
+		}
+
+		var containers *services.ComposeContainers
+		if canCheckDocker && !force {
+			containers = loadComposeContainers(repoRoot)
+		}
+
+		var hasFailure bool = false
+		for _, serviceName := range serviceNames {
+			if canCheckDocker && !force {
+				var serviceDirectory string = filepath.Join(repoRoot, config.DockerServicesDir, serviceName)
+				state, err := services.GetActiveServiceState(serviceDirectory, containers)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to get the state of %s: %v\n", serviceName, err)
+					hasFailure = true
+					continue
+				}
+				if state.ServiceState.IsActive() {
+					fmt.Fprintf(os.Stderr, "Skipping %s as it is running, use --force to clean it anyway\n", serviceName)
+					hasFailure = true
+					continue
+				}
+			}
+
+			results, err := services.CleanService(repoRoot, serviceName, shred)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to clean %s: %v\n", serviceName, err)
+				hasFailure = true
+				continue
+			}
+
+			for _, result := range results {
+				var decryptedFile string = result.DecryptedFile
+				if relativePath, err := filepath.Rel(repoRoot, result.DecryptedFile); err == nil {
+					decryptedFile = relativePath
+				}
+
+				if result.Removed {
+					fmt.Printf("Removed %s\n", decryptedFile)
+				} else {
+					fmt.Fprintf(os.Stderr, "Kept %s: %v\n", decryptedFile, result.Err)
+					hasFailure = true
+				}
+			}
+		}
+
+		if hasFailure {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(cleanCmd)
+	cleanCmd.Flags().StringP("name", "n", "", "The name of the service")
+	cleanCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service")
+	cleanCmd.Flags().Bool("all", false, "Remove the decrypted secrets of every service")
+	cleanCmd.Flags().Bool("shred", false, "Overwrite the content of the decrypted files before removing them")
+	cleanCmd.Flags().BoolP("force", "f", false, "Remove the decrypted secrets even if the service is running")
+}
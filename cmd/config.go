@@ -19,6 +19,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/AlstonChan/composectl/internal/config"
 	"github.com/AlstonChan/composectl/internal/services"
@@ -29,20 +30,52 @@ import (
 // This config command shows all the configuration for the
 // composectl applicationset by the `composectl set` command
 var configCmd = &cobra.Command{
-	Use:   "config",
-	Short: "Show the configuration that has been set for the application",
+	Use:         "config",
+	Annotations: map[string]string{OUTPUT_STRUCTURED_ANNOTATION: "true"},
+	Short:       "Show the configuration that has been set for the application",
 	Example: `  To show all the application configuration:
-    composectl config`,
+    composectl config
+
+  As a json document for scripts:
+    composectl config --output json`,
 	Run: func(cmd *cobra.Command, args []string) {
 		services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
 
 		var repoPath string = viper.GetString(CONFIG_REPO_PATH)
 		var agePubKey string = viper.GetString(CONFIG_AGE_PUBKEY)
 		var s3Bucket string = viper.GetString(CONFIG_AWS_S3_BUCKET)
+		var secretPatterns string = viper.GetString(CONFIG_SECRET_PATTERNS)
+		var secretMaxAge string = viper.GetString(CONFIG_SECRET_MAX_AGE)
+		var vaultAddr string = viper.GetString(CONFIG_VAULT_ADDR)
+		var vaultTokenSource string = viper.GetString(CONFIG_VAULT_TOKEN_SOURCE)
+		var vaultTransitKey string = viper.GetString(CONFIG_VAULT_TRANSIT_KEY)
+
+		if isStructuredOutput() {
+			var document configDocument = configDocument{
+				SchemaVersion:    OUTPUT_SCHEMA_VERSION,
+				RepoPath:         repoPath,
+				AgePubkeys:       append([]string{}, services.SplitRecipients(agePubKey)...),
+				SecretPatterns:   append([]string{}, services.SplitList(secretPatterns)...),
+				SecretMaxAgeDays: viper.GetInt(CONFIG_SECRET_MAX_AGE),
+				Vault: vaultConfigDocument{Address: vaultAddr, TokenSource: vaultTokenSource,
+					TransitKey: vaultTransitKey},
+				S3Bucket: s3Bucket,
+			}
+			if err := printStructured(document); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing the output: %v\n", err)
+				exitStructuredOutput()
+			}
+			return
+		}
 
 		fmt.Println("composectl configuration")
 		fmt.Printf("Repository path: %s\n", orDefault(repoPath, "Not set"))
-		fmt.Printf("Age public key: %s\n", orDefault(agePubKey, "Not set"))
+		fmt.Printf("Age public key: %s\n", orDefault(strings.Join(services.SplitRecipients(agePubKey), ", "), "Not set"))
+		fmt.Printf("Secret patterns: %s\n", orDefault(strings.Join(services.SplitList(secretPatterns), ", "), "Not set"))
+		fmt.Printf("Secret max age (days): %s\n", orDefault(secretMaxAge, "Not set"))
+		fmt.Printf("Vault address: %s\n", orDefault(vaultAddr, "Not set"))
+		fmt.Printf("Vault token source: %s\n", orDefault(vaultTokenSource, "Not set"))
+		fmt.Printf("Vault transit key: %s\n", orDefault(vaultTransitKey, "Not set"))
 		fmt.Println("Self Host Compose configuration")
 		fmt.Printf("AWS S3 bucket to restore backup: %s\n", orDefault(s3Bucket, "Not set"))
 	},
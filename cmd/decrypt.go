@@ -17,11 +17,17 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
 
 	"github.com/AlstonChan/composectl/internal/config"
-	"github.com/AlstonChan/composectl/internal/deps"
 	"github.com/AlstonChan/composectl/internal/services"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -32,7 +38,8 @@ import (
 // To decrypt the age encrypted secrets, the private key that
 // correspond the public key used to encrypted the file is
 // needed. It will search for all location that sops by default
-// would source the keys.txt file.
+// would source the keys.txt file, or the SSH private key from
+// SOPS_AGE_SSH_PRIVATE_KEY_FILE, ~/.ssh/id_ed25519 or ~/.ssh/id_rsa.
 var decryptCmd = &cobra.Command{
 	Use:   "decrypt",
 	Short: "Decrypt the secrets of the specified service",
@@ -42,7 +49,12 @@ var decryptCmd = &cobra.Command{
 	it will overwrite the file content.
 	
 	To get the index of the secret that you want to decrypt. Use 
-	the service command`,
+	the service command
+	
+	To decrypt every secret of every service, or a selection of 
+	services, use --all-services or --services. The secrets are 
+	decrypted in parallel and a summary is printed at the end, 
+	the command exits with a non-zero code if any secret failed.`,
 	Example: `  Decrypt a Docker service's secrets:
 
   # By service sequence (from 'composectl list')
@@ -59,6 +71,12 @@ var decryptCmd = &cobra.Command{
 
   # to overwrite existing secrets
   composectl decrypt -n gitea -i 1 -o
+
+  # for all secrets of every service in the repository
+  composectl decrypt --all-services
+
+  # for all secrets of a selection of services
+  composectl decrypt --services gitea,traefik -o
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		name, _ := cmd.Flags().GetString("name")
@@ -68,6 +86,40 @@ var decryptCmd = &cobra.Command{
 		index, _ := cmd.Flags().GetInt("index")
 		overwrite, _ := cmd.Flags().GetBool("overwrite")
 
+		allServices, _ := cmd.Flags().GetBool("all-services")
+		selectedServices, _ := cmd.Flags().GetStringSlice("services")
+		workers, _ := cmd.Flags().GetInt("workers")
+
+		if allServices || len(selectedServices) > 0 {
+			if allServices && len(selectedServices) > 0 {
+				fmt.Fprintln(os.Stderr, "Cannot use both --all-services and --services")
+				return
+			}
+
+			if err := checkSops(); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+
+			if repoPath == "" {
+				services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+				if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+					repoPath = val
+				}
+			}
+
+			repoRoot, err := services.ResolveRepoRoot(repoPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+				os.Exit(1)
+			}
+
+			if !decryptServices(repoRoot, selectedServices, overwrite, workers) {
+				os.Exit(1)
+			}
+			return
+		}
+
 		if name == "" && sequence <= 0 {
 			fmt.Fprintln(os.Stderr, "Either the service name or sequence must be specified correctly!")
 			return
@@ -78,7 +130,7 @@ var decryptCmd = &cobra.Command{
 			return
 		}
 
-		if err := deps.CheckSops(); err != nil {
+		if err := checkSops(); err != nil {
 			fmt.Fprintln(os.Stderr, "Error:", err)
 			return
 		}
@@ -139,6 +191,124 @@ var decryptCmd = &cobra.Command{
 	},
 }
 
+type decryptJob struct {
+	service string
+	index   int
+	file    services.ServiceFile
+}
+
+type decryptJobResult struct {
+	decryptJob
+	err error
+}
+
+func processDecryptJob(channel <-chan decryptJob, result []decryptJobResult, counter *int32,
+	repoRoot string, overwrite bool) {
+	for job := range channel {
+		_, err := services.DecryptServiceFile(repoRoot, job.service, job.index, job.file, overwrite)
+
+		// Atomically get the next index
+		idx := atomic.AddInt32(counter, 1) - 1
+		result[idx] = decryptJobResult{decryptJob: job, err: err}
+	}
+}
+
+// decryptServices decrypts every secret of the given services, or of every
+// service when none is given, with a bounded pool of workers and prints a
+// summary. It returns false when any of the secrets failed to decrypt.
+func decryptServices(repoRoot string, serviceNames []string, overwrite bool, numWorkers int) bool {
+	if len(serviceNames) == 0 {
+		var err error
+		serviceNames, err = services.ListAllService(repoRoot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+			return false
+		}
+	}
+
+	var jobs []decryptJob
+	for _, serviceName := range serviceNames {
+		var sequence int = 0
+		var name string = serviceName
+		if _, err := services.ValidateService(repoRoot, &sequence, &name); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return false
+		}
+
+		files, err := services.ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error resolving service's details: %v\n", err)
+			return false
+		}
+
+		for index, file := range files {
+			jobs = append(jobs, decryptJob{service: name, index: index + 1, file: file})
+		}
+	}
+
+	if len(jobs) == 0 {
+		fmt.Println("There are no secrets to decrypt")
+		return true
+	}
+
+	var jobWg sync.WaitGroup
+	var jobChannel chan decryptJob = make(chan decryptJob)
+
+	// The output data slice with pre-occupied capacity according to the
+	// job list to avoid further dynamic allocating during decryption
+	var jobResults []decryptJobResult = make([]decryptJobResult, len(jobs))
+	// Atomic counter to track the count of processed job in the jobResults
+	var atomicCounter int32 = 0
+
+	// Start worker goroutines
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	for i := 1; i <= numWorkers; i++ {
+		jobWg.Add(1)
+		go func() {
+			defer jobWg.Done()
+			processDecryptJob(jobChannel, jobResults, &atomicCounter, repoRoot, overwrite)
+		}()
+	}
+
+	// Populate channel with jobs
+	for _, job := range jobs {
+		jobChannel <- job
+	}
+	close(jobChannel)
+	jobWg.Wait()
+
+	sort.SliceStable(jobResults, func(i, j int) bool {
+		if jobResults[i].service != jobResults[j].service {
+			return jobResults[i].service < jobResults[j].service
+		}
+		return jobResults[i].index < jobResults[j].index
+	})
+
+	var succeeded, skipped, failed int = 0, 0, 0
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SERVICE\tSECRET\tRESULT\tDETAIL")
+	for _, result := range jobResults {
+		var status, detail string = "Decrypted", ""
+		switch {
+		case result.err == nil:
+			succeeded++
+		case errors.Is(result.err, services.ErrDecryptedFileExists):
+			status, detail = "Skipped", "already decrypted"
+			skipped++
+		default:
+			status, detail = "Failed", result.err.Error()
+			failed++
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", result.service, filepath.ToSlash(result.file.Filename), status, detail)
+	}
+	writer.Flush()
+
+	fmt.Printf("\n%d decrypted, %d skipped, %d failed\n", succeeded, skipped, failed)
+	return failed == 0
+}
+
 func init() {
 	RootCmd.AddCommand(decryptCmd)
 	decryptCmd.Flags().StringP("name", "n", "", "The name of the service")
@@ -146,4 +316,7 @@ func init() {
 	decryptCmd.Flags().BoolP("decrypt-all", "a", false, "Decrypt all secrets of the service")
 	decryptCmd.Flags().IntP("index", "i", 0, "Specify the index of the secrets to decrypt")
 	decryptCmd.Flags().BoolP("overwrite", "o", false, "Whether to overwrite the file if it already exists")
+	decryptCmd.Flags().Bool("all-services", false, "Decrypt all secrets of every service in the repository")
+	decryptCmd.Flags().StringSlice("services", nil, "Decrypt all secrets of the given comma separated services")
+	decryptCmd.Flags().IntP("workers", "j", 0, "The number of secrets to decrypt in parallel (default to the number of CPUs)")
 }
@@ -0,0 +1,158 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command shows what has changed in the decrypted working
+// file of a secret compared to the encrypted version, so that
+// the changes can be reviewed before re-encrypting. The encrypted
+// file is only ever decrypted in memory.
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes between the decrypted secrets and the encrypted secrets",
+	Long: `Show the changes between the decrypted working file and the
+	encrypted version of the secrets as a unified diff.
+
+	The secret values are masked unless --show-values is specified.
+	The keys of dotenv, ini, toml, yaml and json secrets are kept,
+	while the changed lines of the other secrets are masked as a
+	whole. For dotenv, yaml and json secrets, the added, removed and
+	changed keys are listed after the diff as well.`,
+	Example: `  Show the changes of a docker service's secrets:
+
+  # all decrypted secrets by service name (as per 'composectl list')
+  composectl diff -n gitea
+
+  # a particular secret by index (as per 'composectl service')
+  composectl diff -s 12 -i 1
+
+  # the changes with the values shown
+  composectl diff -n gitea -i 1 --show-values
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+
+		index, _ := cmd.Flags().GetInt("index")
+		showValues, _ := cmd.Flags().GetBool("show-values")
+
+		if name == "" && sequence <= 0 {
+			fmt.Fprintln(os.Stderr, "Either the service name or sequence must be specified correctly!")
+			return
+		}
+
+		if err := checkSops(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		if serviceLists == nil && err == nil {
+			return
+		}
+
+		files, err := services.ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error resolving service's details: %v\n", err)
+			return
+		}
+
+		if index > len(files) {
+			fmt.Fprintf(os.Stderr, "the file given index %d does not exists\n", index)
+			return
+		}
+
+		for fileIndex, file := range files {
+			if index > 0 && fileIndex+1 != index {
+				continue
+			}
+			// Only compare decrypted secrets unless the user asked for it
+			if index <= 0 && !file.HasDecryptedVersion {
+				continue
+			}
+
+			diff, err := services.DiffSecretFile(repoRoot, name, file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				continue
+			}
+
+			if showValues {
+				fmt.Print(diff.Unified)
+			} else {
+				fmt.Print(diff.MaskedUnified)
+			}
+
+			if !diff.IsStructured || len(diff.Keys) == 0 {
+				continue
+			}
+
+			fmt.Printf("Changed keys of %s:\n", file.Filename)
+			for _, key := range diff.Keys {
+				var oldValue, newValue string = key.OldValue, key.NewValue
+				if !showValues {
+					oldValue = services.MaskSecretValue(oldValue)
+					newValue = services.MaskSecretValue(newValue)
+				}
+
+				switch key.Change {
+				case services.KeyAdded:
+					fmt.Printf("  + %s = %s\n", key.Key, newValue)
+				case services.KeyRemoved:
+					fmt.Printf("  - %s = %s\n", key.Key, oldValue)
+				case services.KeyChanged:
+					fmt.Printf("  ~ %s: %s -> %s\n", key.Key, oldValue, newValue)
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringP("name", "n", "", "The name of the service")
+	diffCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service")
+	diffCmd.Flags().IntP("index", "i", 0, "Specify the index of the secret to diff (default to all decrypted secrets)")
+	diffCmd.Flags().Bool("show-values", false, "Show the secret values in the diff instead of masking them")
+}
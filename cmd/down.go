@@ -0,0 +1,54 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// This command stops and removes the containers of a service
+// with docker compose. Compose refuses to parse a compose file
+// whose env_file doesn't exist, so --in-memory is available
+// here as well
+var downCmd = &cobra.Command{
+	Use:   "down [-- compose down flags]",
+	Short: "Stop and remove the containers of a service with docker compose",
+	Example: `  Stop a docker service:
+
+  # by service name (as per 'composectl list')
+  composectl down -n gitea
+
+  # when the secrets are not decrypted on disk
+  composectl down -n gitea --in-memory
+
+  # with extra flags for docker compose down
+  composectl down -n gitea -- --volumes
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runServiceCompose(cmd, append([]string{"down"}, args...)))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(downCmd)
+	downCmd.Flags().StringP("name", "n", "", "The name of the service")
+	downCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service")
+	downCmd.Flags().String("variant", "", "The compose file variant, e.g. dev for compose.dev.yml (default to the base compose file)")
+	downCmd.Flags().Bool("in-memory", false, "Decrypt the secrets to a tmpfs for the duration of the command instead of the checkout")
+}
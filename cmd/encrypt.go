@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/AlstonChan/composectl/internal/config"
 	"github.com/AlstonChan/composectl/internal/deps"
@@ -34,9 +35,21 @@ import (
 // This command will automatically detect the file type based
 // on the target file extension, and use the correct format
 // for encryption. As for file format that isn't recognize, it
-// will be encrypted as a json file, but decryption with the
-// 'composectl decrypt' would recognize it and still decrypt
-// it back to the original file
+// will be encrypted in binary mode, which preserves every byte
+// of certificates, keystores and databases, and decryption
+// with 'composectl decrypt' restores the original file.
+// For yaml and json, --encrypted-regex or --unencrypted-suffix
+// keep the non-secret keys readable in code review.
+// With --all, every plaintext secret of the service matching
+// the 'secret-patterns' config, or the path_regex of the
+// .sops.yaml creation rules, is encrypted when it has no
+// encrypted counterpart or was modified since it was encrypted.
+// When the repository has a .sops.yaml with a creation rule
+// that matches the file, the rule is applied by sops so that
+// the result is identical to running sops directly.
+// With --hc-vault-transit, or the 'vault-transit-key' config,
+// the secrets are also encrypted to a HashiCorp Vault transit
+// key, so that a host with access to Vault can decrypt them
 var encryptCmd = &cobra.Command{
 	Use:   "encrypt",
 	Short: "Encrypt the secrets of the specified service",
@@ -51,11 +64,29 @@ var encryptCmd = &cobra.Command{
   # to overwrite existing encrypted secret
   composectl encrypt -n gitea -f private-key.pem -o
 
-  # for all secrets of the service
-  composectl decrypt -n gitea -a
+  # for all plaintext secrets of the service matching the secret patterns
+  composectl encrypt -n gitea --all
+
+  # to only show the plaintext secrets that would be encrypted
+  composectl encrypt -n gitea --all --dry-run
 
   # to specify a age public key if not set with 'composectl set'
   composectl encrypt -n gitea -f config.yaml -p age1....
+
+  # to encrypt to multiple age public keys
+  composectl encrypt -n gitea -f config.yaml -p age1...,age1...
+
+  # to encrypt to an SSH public key, which age accepts as a recipient
+  composectl encrypt -n gitea -f config.yaml -p "ssh-ed25519 AAAA..."
+
+  # to only encrypt the values of the password and token keys
+  composectl encrypt -n gitea -f config.yaml --encrypted-regex '^(password|token)$'
+
+  # to leave the keys ending with _unencrypted readable
+  composectl encrypt -n gitea -f config.json --unencrypted-suffix _unencrypted
+
+  # to also encrypt to a Vault transit key, relative to the 'vault-addr' config
+  composectl encrypt -n gitea -f .env --hc-vault-transit transit/keys/sops
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		name, _ := cmd.Flags().GetString("name")
@@ -64,13 +95,23 @@ var encryptCmd = &cobra.Command{
 		publicKey, _ := cmd.Flags().GetString("pubkey")
 		file, _ := cmd.Flags().GetString("file")
 		overwrite, _ := cmd.Flags().GetBool("overwrite")
+		encryptedRegex, _ := cmd.Flags().GetString("encrypted-regex")
+		unencryptedSuffix, _ := cmd.Flags().GetString("unencrypted-suffix")
+		encryptAll, _ := cmd.Flags().GetBool("all")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		vaultKeys, _ := cmd.Flags().GetString("hc-vault-transit")
 
 		if name == "" && sequence <= 0 {
 			fmt.Fprintln(os.Stderr, "Either the service name or sequence must be specified correctly!")
 			return
 		}
 
-		if err := deps.CheckSops(); err != nil {
+		if encryptAll == (file != "") {
+			fmt.Fprintln(os.Stderr, "Either a file or --all must be specified!")
+			return
+		}
+
+		if err := checkSops(); err != nil {
 			fmt.Fprintln(os.Stderr, "Error:", err)
 			return
 		}
@@ -98,38 +139,352 @@ var encryptCmd = &cobra.Command{
 			return
 		}
 
-		if publicKey == "" {
-			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
-			if val := viper.GetString(CONFIG_AGE_PUBKEY); val != "" {
-				publicKey = val
-			} else {
-				var err error
-				publicKey, err = services.GetPublicKeyFromDefaultLocation()
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "An error occurred while getting the public key: %v\n", err)
-					return
-				}
+		var vaultUris []string
+		if !dryRun {
+			vaultUris, err = resolveVaultTransitUris(vaultKeys)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to use the Vault transit key: %v\n", err)
+				return
 			}
 		}
 
+		if encryptAll {
+			var partialOptions services.EncryptOptions = services.EncryptOptions{
+				EncryptedRegex:    encryptedRegex,
+				UnencryptedSuffix: unencryptedSuffix,
+			}
+			if !encryptAllSecrets(repoRoot, name, publicKey, vaultUris, partialOptions, dryRun) {
+				os.Exit(1)
+			}
+			return
+		}
+
 		var targetFile string = filepath.Join(repoRoot, config.DockerServicesDir, name, file)
 		if _, err := os.Stat(targetFile); err != nil {
 			fmt.Fprintf(os.Stderr, "The provided file %s does not exists!\n", targetFile)
 			return
 		}
 
-		if err := services.EncryptFile(targetFile, publicKey, overwrite); err != nil {
+		options, err := resolveEncryptOptions(repoRoot, name, targetFile, publicKey, vaultUris)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurred while resolving the recipients: %v\n", err)
+			return
+		}
+		options.Overwrite = overwrite
+		if encryptedRegex != "" || unencryptedSuffix != "" {
+			options.EncryptedRegex = encryptedRegex
+			options.UnencryptedSuffix = unencryptedSuffix
+		}
+
+		if err := services.EncryptFile(targetFile, options); err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			return
 		}
 	},
 }
 
+// encryptAllSecrets prints the plaintext secrets of the service that need
+// to be encrypted, then encrypts them with the overwrite semantics unless
+// dryRun is true. It returns false if any of them failed to encrypt.
+func encryptAllSecrets(repoRoot string, name string, publicKey string, vaultUris []string,
+	partialOptions services.EncryptOptions, dryRun bool) bool {
+	sopsConfig, err := services.LoadSopsConfig(repoRoot)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return false
+	}
+
+	services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+	var patterns services.SecretPatterns = services.SecretPatterns{
+		Globs:      services.SplitList(viper.GetString(CONFIG_SECRET_PATTERNS)),
+		SopsConfig: sopsConfig,
+	}
+	if len(patterns.Globs) == 0 && sopsConfig == nil {
+		fmt.Fprintf(os.Stderr, "No secret patterns, set them with 'composectl set %s=.env,*.pem' or add a .sops.yaml\n",
+			CONFIG_SECRET_PATTERNS)
+		return false
+	}
+
+	entries, err := services.PlanServiceEncryption(repoRoot, name, patterns)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return false
+	}
+
+	var pending int = 0
+	for _, entry := range entries {
+		if entry.Action != services.EncryptSkipped {
+			pending++
+		}
+	}
+	if len(entries) == 0 {
+		fmt.Println("All plaintext secrets are already encrypted")
+		return true
+	}
+
+	fmt.Printf("%d plaintext secrets will be encrypted:\n", pending)
+	for _, entry := range entries {
+		if entry.Action == services.EncryptSkipped {
+			fmt.Printf("  %-10s %s (sync state %s, use 'composectl sync --prefer encrypt')\n",
+				entry.Action, entry.File, services.GetSecretSyncStateString(entry.EncryptedState))
+			continue
+		}
+		fmt.Printf("  %-10s %s -> %s\n", entry.Action, entry.File,
+			filepath.ToSlash(filepath.Join(filepath.Dir(entry.File), filepath.Base(entry.EncryptedPath))))
+	}
+	fmt.Print("\n")
+
+	if dryRun {
+		return true
+	}
+
+	var failed int = 0
+	for _, entry := range entries {
+		if entry.Action == services.EncryptSkipped {
+			continue
+		}
+
+		options, err := resolveEncryptOptions(repoRoot, name, entry.PlaintextPath, publicKey, vaultUris)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurred while resolving the recipients: %v\n", err)
+			return false
+		}
+		options.Overwrite = true
+		if partialOptions.EncryptedRegex != "" || partialOptions.UnencryptedSuffix != "" {
+			options.EncryptedRegex = partialOptions.EncryptedRegex
+			options.UnencryptedSuffix = partialOptions.UnencryptedSuffix
+		}
+
+		// Keep the partial encryption a modified secret was encrypted with
+		if entry.Action == services.EncryptModified && options.EncryptedRegex == "" && options.UnencryptedSuffix == "" {
+			if metadata, err := services.ReadSopsMetadata(entry.EncryptedPath); err == nil {
+				options.EncryptedRegex = metadata.EncryptedRegex
+				options.UnencryptedSuffix = metadata.UnencryptedSuffix
+			}
+		}
+
+		// The partial encryption options only apply to yaml and json
+		if fileType := services.GetEncryptedFileType(entry.EncryptedPath); fileType != "yaml" && fileType != "json" {
+			options.EncryptedRegex = ""
+			options.UnencryptedSuffix = ""
+		}
+
+		if err := services.EncryptFileTo(entry.PlaintextPath, entry.EncryptedPath, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to encrypt %s: %v\n", entry.File, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d of %d secrets failed to encrypt\n", failed, pending)
+		return false
+	}
+	return true
+}
+
+// resolveEncryptOptions returns the recipients to encrypt the target file
+// with. The comma separated public keys given by flag have the highest
+// precedence, followed by the matching creation rule of the repository
+// .sops.yaml, the public keys set with 'composectl set', then the public
+// key of the sops keys.txt file or of the SSH private key used by sops.
+// The public keys of the team members that can access the service and
+// the Vault transit keys are added to the configured recipients, in which
+// case the keys and the partial encryption settings of the matching
+// creation rule are passed to sops directly instead of the rule. An
+// error is returned when the secrets policy doesn't allow the recipients.
+func resolveEncryptOptions(repoRoot string, name string, targetFile string, publicKeys string,
+	vaultUris []string) (services.EncryptOptions, error) {
+	options, err := resolveEncryptKeys(repoRoot, name, targetFile, publicKeys, vaultUris)
+	if err != nil {
+		return services.EncryptOptions{}, err
+	}
+
+	if err := checkRecipientsPolicy(repoRoot, name, targetFile, options); err != nil {
+		return services.EncryptOptions{}, err
+	}
+	return options, nil
+}
+
+// checkRecipientsPolicy returns an error when the master keys of the
+// encrypt options are not the recipients allowed by the secrets policy
+func checkRecipientsPolicy(repoRoot string, name string, targetFile string, options services.EncryptOptions) error {
+	policy, err := services.LoadSecretsPolicy(repoRoot)
+	if err != nil || !policy.HasRecipientsPolicy() {
+		return err
+	}
+
+	team, err := services.LoadTeamManifest(repoRoot)
+	if err != nil {
+		return err
+	}
+
+	var recipients []string = options.MasterKeys()
+	if options.SopsConfigPath != "" {
+		sopsConfig, err := services.LoadSopsConfig(repoRoot)
+		if err != nil {
+			return err
+		}
+		rule, err := sopsConfig.MatchCreationRule(targetFile)
+		if err != nil {
+			return err
+		}
+		recipients = rule.MasterKeys()
+	}
+
+	return policy.CheckRecipients(name, team, recipients)
+}
+
+// resolveEncryptKeys returns the recipients to encrypt the target file
+// with, see resolveEncryptOptions
+func resolveEncryptKeys(repoRoot string, name string, targetFile string, publicKeys string,
+	vaultUris []string) (services.EncryptOptions, error) {
+	if recipients := services.SplitRecipients(publicKeys); len(recipients) > 0 {
+		for _, recipient := range recipients {
+			if err := services.ValidateAgeRecipient(recipient); err != nil {
+				return services.EncryptOptions{}, err
+			}
+		}
+		return services.EncryptOptions{Recipients: recipients, HcVaultTransitUris: vaultUris}, nil
+	}
+
+	team, err := services.LoadTeamManifest(repoRoot)
+	if err != nil {
+		return services.EncryptOptions{}, err
+	}
+	var teamRecipients []string = team.RecipientsFor(name)
+
+	sopsConfig, err := services.LoadSopsConfig(repoRoot)
+	if err != nil {
+		return services.EncryptOptions{}, err
+	}
+	if sopsConfig != nil {
+		rule, err := sopsConfig.MatchCreationRule(targetFile)
+		if err != nil {
+			return services.EncryptOptions{}, err
+		}
+		if rule != nil {
+			var recipients []string = appendMissing(rule.AgeRecipients(), teamRecipients)
+			if len(vaultUris) == 0 && len(recipients) == len(rule.AgeRecipients()) {
+				return services.EncryptOptions{SopsConfigPath: sopsConfig.Path}, nil
+			}
+
+			// The team recipients and the Vault transit keys are added to the keys of the rule
+			options, err := rule.KeyOptions()
+			if err != nil {
+				return services.EncryptOptions{}, err
+			}
+			options.Recipients = recipients
+			options.HcVaultTransitUris = appendMissing(options.HcVaultTransitUris, vaultUris)
+
+			// The partial encryption options only apply to yaml and json
+			if fileType := services.GetEncryptedFileType(targetFile + ".enc"); fileType != "yaml" && fileType != "json" {
+				options.EncryptedRegex = ""
+				options.UnencryptedSuffix = ""
+			}
+			return options, nil
+		}
+	}
+
+	services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+	if recipients := services.SplitRecipients(viper.GetString(CONFIG_AGE_PUBKEY)); len(recipients) > 0 {
+		return services.EncryptOptions{Recipients: appendMissing(recipients, teamRecipients), HcVaultTransitUris: vaultUris}, nil
+	}
+
+	publicKey, err := services.GetPublicKeyFromDefaultLocation()
+	if err != nil {
+		// The secret can still be encrypted to the Vault transit keys alone
+		if len(vaultUris) > 0 {
+			return services.EncryptOptions{HcVaultTransitUris: vaultUris}, nil
+		}
+		return services.EncryptOptions{}, err
+	}
+	return services.EncryptOptions{Recipients: appendMissing([]string{publicKey}, teamRecipients), HcVaultTransitUris: vaultUris}, nil
+}
+
+// appendMissing appends the values that are not in the slice yet
+func appendMissing(values []string, additions []string) []string {
+	var result []string = slices.Clone(values)
+	for _, value := range additions {
+		if !slices.Contains(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// loadVaultConfig returns the Vault configuration set with 'composectl set'
+func loadVaultConfig() services.VaultConfig {
+	services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+	return services.VaultConfig{
+		Address:     viper.GetString(CONFIG_VAULT_ADDR),
+		TokenSource: viper.GetString(CONFIG_VAULT_TOKEN_SOURCE),
+		KeyPath:     viper.GetString(CONFIG_VAULT_TRANSIT_KEY),
+	}
+}
+
+// checkSops checks the sops dependency and exports the Vault configuration
+// for the sops processes started by the command
+func checkSops() error {
+	if err := deps.CheckSops(); err != nil {
+		return err
+	}
+	exportVaultEnv()
+	return nil
+}
+
+// exportVaultEnv sets the Vault address and token that sops reads from the
+// environment to encrypt and decrypt with the Vault transit keys
+func exportVaultEnv() {
+	if err := services.ExportVaultEnv(loadVaultConfig()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to read the Vault token: %v\n", err)
+	}
+}
+
+// resolveVaultTransitUris returns the URIs of the comma separated Vault
+// transit keys given by flag, otherwise of the transit key set with
+// 'composectl set'. The Vault server is checked to be healthy and a
+// token to be available before they are used.
+func resolveVaultTransitUris(vaultKeys string) ([]string, error) {
+	var vaultConfig services.VaultConfig = loadVaultConfig()
+
+	var keys []string = services.SplitList(vaultKeys)
+	if len(keys) == 0 && vaultConfig.KeyPath != "" {
+		keys = []string{vaultConfig.KeyPath}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var uris []string
+	for _, key := range keys {
+		uri, err := services.ResolveVaultTransitUri(vaultConfig.Address, key)
+		if err != nil {
+			return nil, err
+		}
+		uris = append(uris, uri)
+	}
+
+	// The token itself is only checked by sops
+	if _, err := vaultConfig.ResolveToken(); err != nil {
+		return nil, err
+	}
+	if err := deps.CheckVault(uris); err != nil {
+		return nil, err
+	}
+
+	return uris, nil
+}
+
 func init() {
 	RootCmd.AddCommand(encryptCmd)
 	encryptCmd.Flags().StringP("name", "n", "", "The name of the service")
 	encryptCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service")
 	encryptCmd.Flags().StringP("file", "f", "", "The filename/file path to encrypt of the service")
-	encryptCmd.Flags().StringP("pubkey", "p", "", "The age public key to encrypt secrets")
+	encryptCmd.Flags().StringP("pubkey", "p", "", "The comma separated age or SSH public keys to encrypt secrets")
 	encryptCmd.Flags().BoolP("overwrite", "o", false, "Whether to overwrite the file if it already exists")
+	encryptCmd.Flags().BoolP("all", "a", false, "Encrypt all plaintext secrets of the service matching the secret patterns")
+	encryptCmd.Flags().Bool("dry-run", false, "Only show the plaintext secrets that --all would encrypt")
+	encryptCmd.Flags().String("encrypted-regex", "", "Only encrypt the values of the keys matching this regex (yaml and json only)")
+	encryptCmd.Flags().String("unencrypted-suffix", "", "Leave the values of the keys ending with this suffix unencrypted (yaml and json only)")
+	encryptCmd.Flags().String("hc-vault-transit", "", "The comma separated Vault transit keys to encrypt secrets, e.g. transit/keys/sops")
 }
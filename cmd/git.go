@@ -0,0 +1,165 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The git command groups the commands that integrate the
+// encrypted files with git diff and git merge
+var gitCmd = &cobra.Command{
+	Use:   "git",
+	Short: "Integrate the encrypted secrets with git diff and git merge",
+}
+
+// This command is the textconv of the git diff driver, it
+// prints the decrypted content of an encrypted file so that
+// 'git diff' and 'git log -p' show readable changes
+var gitTextconvCmd = &cobra.Command{
+	Use:   "textconv <file>",
+	Short: "Print the decrypted content of an encrypted file for git diff",
+	Long: `Print the decrypted content of an encrypted file for git diff.
+
+	When the file can't be decrypted, for example because the
+	private key isn't available, the encrypted content is
+	printed as it is so that git diff still works.
+
+	This command is called by git after 'composectl git setup'.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exportVaultEnv()
+
+		content, err := services.DecryptToMemory(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "composectl: showing %s encrypted: %v\n", args[0], err)
+
+			content, err = os.ReadFile(args[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
+
+		os.Stdout.Write(content)
+	},
+}
+
+// This command is the git merge driver of the encrypted
+// files, it merges the decrypted content key by key and
+// encrypts the result again
+var gitMergeDriverCmd = &cobra.Command{
+	Use:   "merge-driver <base> <current> <other> [pathname]",
+	Short: "Merge the encrypted secrets key by key for git merge",
+	Long: `Merge the encrypted secrets key by key for git merge.
+
+	The common ancestor, the current and the other version are
+	decrypted and merged key by key for dotenv, yaml and json
+	files. The result is encrypted again into the current file.
+
+	When both sides changed the same key, the conflicting keys
+	are printed and the current file is left untouched, resolve
+	the conflict by editing the decrypted file and encrypting it.
+
+	This command is called by git after 'composectl git setup'.`,
+	Args: cobra.RangeArgs(3, 4),
+	Run: func(cmd *cobra.Command, args []string) {
+		var pathname string = args[1]
+		if len(args) == 4 {
+			pathname = args[3]
+		}
+
+		exportVaultEnv()
+
+		// git runs the merge driver at the top level of the work tree
+		repoRoot, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "composectl: unable to merge %s: %v\n", pathname, err)
+			os.Exit(1)
+		}
+
+		conflicts, err := services.MergeEncryptedFiles(repoRoot, args[0], args[1], args[2], pathname)
+		if errors.Is(err, services.ErrMergeConflict) {
+			fmt.Fprintf(os.Stderr, "composectl: merge conflict in %s: %s\n", pathname, strings.Join(conflicts, ", "))
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "composectl: unable to merge %s: %v\n", pathname, err)
+			os.Exit(1)
+		}
+	},
+}
+
+// This command registers composectl as the diff and merge
+// driver of the encrypted files in the repository
+var gitSetupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Register the diff and merge driver in .gitattributes and the git config",
+	Long: `Register the diff and merge driver of the encrypted files.
+
+	The encrypted file patterns are added to the .gitattributes
+	of the repository, commit it to share it with the team. The
+	drivers are set in the local git config, so every clone has
+	to run this command once.`,
+	Example: `  Set up the git integration:
+
+  # using the default repo-path set by 'composectl set'
+  composectl git setup
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to locate the composectl executable: %v\n", err)
+			return
+		}
+
+		if err := services.SetupGitIntegration(repoRoot, executable); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		fmt.Println("Git diff and merge driver registered for the encrypted files")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(gitCmd)
+	gitCmd.AddCommand(gitTextconvCmd)
+	gitCmd.AddCommand(gitMergeDriverCmd)
+	gitCmd.AddCommand(gitSetupCmd)
+}
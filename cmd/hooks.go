@@ -0,0 +1,86 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The hooks command groups the commands that manage the git
+// hooks of the repository
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "Manage the git hooks of the repository",
+}
+
+// This command installs a git pre-commit hook that runs
+// 'composectl secrets scan --staged', so that a decrypted
+// secret can't be committed by accident
+var hooksInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install a pre-commit hook that blocks committing plaintext secrets",
+	Example: `  Install the pre-commit hook:
+
+  # using the default repo-path set by 'composectl set'
+  composectl hooks install
+
+  # replace an existing pre-commit hook
+  composectl hooks install --force
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		force, _ := cmd.Flags().GetBool("force")
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to locate the composectl executable: %v\n", err)
+			return
+		}
+
+		hookPath, err := services.InstallPreCommitHook(repoRoot, executable, force)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		fmt.Printf("Pre-commit hook installed at %s\n", hookPath)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(hooksCmd)
+	hooksCmd.AddCommand(hooksInstallCmd)
+	hooksInstallCmd.Flags().BoolP("force", "f", false, "Replace an existing pre-commit hook that wasn't installed by composectl")
+}
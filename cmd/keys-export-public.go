@@ -0,0 +1,60 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// This command prints the public keys of the age identities,
+// so that they can be shared with the admins of the repository
+var keysExportPublicCmd = &cobra.Command{
+	Use:   "export-public",
+	Short: "Print the public keys of the age identities",
+	Long: `Print the public key of every age identity in the keys.txt
+	file, one per line. The public keys are safe to share and are
+	the recipients to encrypt the secrets to.`,
+	Example: `  Print the public keys to share:
+    composectl keys export-public`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keyFile, err := resolveKeyFile(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to locate the age key file: %v\n", err)
+			return
+		}
+
+		identities, err := services.ReadAgeIdentities(keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		for _, identity := range identities {
+			if identity.PublicKey != "" {
+				fmt.Println(identity.PublicKey)
+			}
+		}
+	},
+}
+
+func init() {
+	keysCmd.AddCommand(keysExportPublicCmd)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// This command generates a new age identity, the same as
+// age-keygen, and appends it to the keys.txt file used by sops
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a new age identity into the keys.txt file",
+	Long: `Generate a new age identity, the same as age-keygen, and
+	append it to the keys.txt file used by sops.
+
+	The keys.txt file and its directory are created with owner only
+	permissions when they don't exist. The existing identities are
+	kept, so the file may hold several identities.
+
+	With --set, the public key is also added to the age-pubkey
+	configuration, so that it is a recipient of the secrets
+	encrypted with 'composectl encrypt'.`,
+	Example: `  Generate a new age identity:
+
+  # into the keys.txt file used by sops
+  composectl keys generate
+
+  # and use it as a recipient for the encryption
+  composectl keys generate --set
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		setPubkey, _ := cmd.Flags().GetBool("set")
+
+		keyFile, err := resolveKeyFile(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to locate the age key file: %v\n", err)
+			return
+		}
+
+		identity, err := services.GenerateAgeIdentity()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to generate the age identity: %v\n", err)
+			return
+		}
+
+		if _, err := services.AddAgeIdentities(keyFile, []services.AgeIdentity{identity}); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to save the age identity: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Age identity written to %s\n", keyFile)
+		fmt.Printf("Public key: %s\n", identity.PublicKey)
+
+		if setPubkey {
+			if err := addConfiguredAgePubkey([]string{identity.PublicKey}); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to set the age public key: %v\n", err)
+			}
+		}
+	},
+}
+
+func init() {
+	keysCmd.AddCommand(keysGenerateCmd)
+	keysGenerateCmd.Flags().Bool("set", false, "Add the public key to the age-pubkey configuration")
+}
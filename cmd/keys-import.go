@@ -0,0 +1,109 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+)
+
+// This command imports the age identities of another file,
+// e.g. one created by age-keygen, into the keys.txt file
+var keysImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import the age identities of a file into the keys.txt file",
+	Long: `Import the age identities of a file, such as one created by
+	age-keygen, into the keys.txt file used by sops.
+
+	Use "-" as the file to read the identities from stdin. The
+	identities that are already in the keys.txt file are skipped.
+
+	With --set, the public keys of the imported identities are
+	also added to the age-pubkey configuration.`,
+	Example: `  Import an age identity:
+
+  # from a file created by age-keygen
+  composectl keys import ./key.txt
+
+  # from stdin
+  cat ./key.txt | composectl keys import -
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		setPubkey, _ := cmd.Flags().GetBool("set")
+
+		var content []byte
+		var err error
+		if args[0] == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read the identities: %v\n", err)
+			return
+		}
+
+		identities, err := services.ParseAgeIdentities(content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to parse the identities: %v\n", err)
+			return
+		}
+		if len(identities) == 0 {
+			fmt.Fprintf(os.Stderr, "No age identity found in %s\n", args[0])
+			return
+		}
+
+		keyFile, err := resolveKeyFile(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to locate the age key file: %v\n", err)
+			return
+		}
+
+		added, err := services.AddAgeIdentities(keyFile, identities)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to save the age identities: %v\n", err)
+			return
+		}
+
+		var publicKeys []string
+		for _, identity := range added {
+			fmt.Printf("Imported %s\n", orDefault(identity.PublicKey, "plugin identity without public key"))
+			if identity.PublicKey != "" && !identity.Plugin {
+				publicKeys = append(publicKeys, identity.PublicKey)
+			}
+		}
+		if skipped := len(identities) - len(added); skipped > 0 {
+			fmt.Printf("Skipped %d identities already in %s\n", skipped, keyFile)
+		}
+
+		if setPubkey && len(publicKeys) > 0 {
+			if err := addConfiguredAgePubkey(publicKeys); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to set the age public key: %v\n", err)
+			}
+		}
+	},
+}
+
+func init() {
+	keysCmd.AddCommand(keysImportCmd)
+	keysImportCmd.Flags().Bool("set", false, "Add the public keys to the age-pubkey configuration")
+}
@@ -0,0 +1,137 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command lists the age identities of the keys.txt file
+// and where each of them is used as a recipient
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the age identities and the recipients they match",
+	Long: `List the age identities of the keys.txt file.
+
+	For each identity, it shows whether its public key is in the
+	age-pubkey configuration and in the creation rules of the
+	repository .sops.yaml, and which secrets of the repository
+	are encrypted to it, i.e. the secrets it can decrypt.`,
+	Example: `  List the age identities:
+    composectl keys list`,
+	Run: func(cmd *cobra.Command, args []string) {
+		keyFile, err := resolveKeyFile(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to locate the age key file: %v\n", err)
+			return
+		}
+
+		identities, err := services.ReadAgeIdentities(keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		if len(identities) == 0 {
+			fmt.Printf("No age identity found in %s\n", keyFile)
+			return
+		}
+
+		services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+		var configured []string = services.SplitRecipients(viper.GetString(CONFIG_AGE_PUBKEY))
+
+		// The repository is optional, the identities are listed even outside of it
+		if repoPath == "" {
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		var sopsConfig *services.SopsConfig = nil
+		var secrets []services.SecretRecipients
+		if repoRoot, err := services.ResolveRepoRoot(repoPath); err == nil {
+			if sopsConfig, err = services.LoadSopsConfig(repoRoot); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+
+			serviceNames, err := services.ListAllService(repoRoot)
+			if err == nil {
+				secrets, err = services.GetSecretRecipients(repoRoot, serviceNames, nil, nil)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: unable to read the secrets recipients: %v\n", err)
+			}
+		}
+
+		fmt.Printf("Age identities in %s\n", keyFile)
+		for index, identity := range identities {
+			fmt.Printf("\n%d. %s\n", index+1, orDefault(identity.PublicKey, "Unknown public key"))
+			if identity.Plugin {
+				fmt.Printf("  Type:          plugin (%s)\n", strings.SplitN(identity.SecretKey, "1", 2)[0])
+			} else {
+				fmt.Println("  Type:          X25519")
+			}
+			if !identity.Created.IsZero() {
+				fmt.Printf("  Created:       %s\n", identity.Created.Local().Format("2006-01-02 15:04:05"))
+			}
+			if identity.PublicKey == "" {
+				continue
+			}
+
+			if slices.Contains(configured, identity.PublicKey) {
+				fmt.Println("  age-pubkey:    yes")
+			} else {
+				fmt.Println("  age-pubkey:    no")
+			}
+
+			if sopsConfig != nil {
+				var rules []string
+				for _, rule := range sopsConfig.CreationRules {
+					if slices.Contains(rule.AgeRecipients(), identity.PublicKey) {
+						rules = append(rules, orDefault(rule.PathRegex, "(any path)"))
+					}
+				}
+				fmt.Printf("  .sops.yaml:    %s\n", orDefault(strings.Join(rules, ", "), "-"))
+			}
+
+			if secrets != nil {
+				var decryptable []string
+				for _, secret := range secrets {
+					if slices.Contains(secret.Metadata.AgeRecipients, identity.PublicKey) {
+						decryptable = append(decryptable, filepath.Join(secret.Service, secret.File.Filename))
+					}
+				}
+				fmt.Printf("  Secrets:       %d of %d\n", len(decryptable), len(secrets))
+				for _, secret := range decryptable {
+					fmt.Printf("    %s\n", secret)
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	keysCmd.AddCommand(keysListCmd)
+}
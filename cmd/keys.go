@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The keys command groups the commands that manage the age
+// identities in the keys.txt file used by sops
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the age identities used to decrypt the secrets",
+	Long: `Manage the age identities in the keys.txt file used by sops.
+
+	The keys.txt file is the one specified by SOPS_AGE_KEY_FILE,
+	otherwise the one in the sops config directory, e.g.
+	$XDG_CONFIG_HOME/sops/age/keys.txt or ~/.config/sops/age/keys.txt.
+	Use --key-file to manage another file.`,
+}
+
+// resolveKeyFile returns the keys.txt file to manage, either the
+// --key-file flag or the keys.txt file used by sops
+func resolveKeyFile(cmd *cobra.Command) (string, error) {
+	if keyFile, _ := cmd.Flags().GetString("key-file"); keyFile != "" {
+		return keyFile, nil
+	}
+	return services.DefaultSopsAgeKeyPath()
+}
+
+// addConfiguredAgePubkey adds the public keys to the age-pubkey
+// configuration, keeping the recipients that are already set
+func addConfiguredAgePubkey(publicKeys []string) error {
+	services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+
+	var recipients []string = services.SplitRecipients(viper.GetString(CONFIG_AGE_PUBKEY))
+	for _, publicKey := range publicKeys {
+		if err := services.ValidateAgeRecipient(publicKey); err != nil {
+			return err
+		}
+		if !slices.Contains(recipients, publicKey) {
+			recipients = append(recipients, publicKey)
+		}
+	}
+
+	viper.Set(CONFIG_AGE_PUBKEY, strings.Join(recipients, ","))
+	if err := viper.WriteConfig(); err != nil {
+		// If config file doesn’t exist, create it
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+			return viper.SafeWriteConfig()
+		}
+		return err
+	}
+
+	fmt.Printf("Age public key set to %s\n", strings.Join(recipients, ","))
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(keysCmd)
+	keysCmd.PersistentFlags().String("key-file", "", "The age keys.txt file to manage instead of the one used by sops")
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -25,6 +26,7 @@ import (
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/AlstonChan/composectl/internal/config"
 	"github.com/AlstonChan/composectl/internal/deps"
@@ -39,30 +41,35 @@ type Service struct {
 }
 type ServiceOutput struct {
 	Service
+	dockerState   services.ServiceState
 	dockerStatus  string
+	healthy       int
+	healthChecked int
+	variant       string
 	decryptStatus services.ServiceDecryptionStatus
+	syncStatus    services.SecretSyncState
 }
 
-func processService(channel <-chan Service, result []ServiceOutput, counter *int32, repoRoot string) {
+func processService(channel <-chan Service, result []ServiceOutput, counter *int32, repoRoot string,
+	containers *services.ComposeContainers) {
 	for service := range channel {
 		var serviceDirectory string = filepath.Join(repoRoot, config.DockerServicesDir, service.name)
 
 		decryptStatus := services.GetDecryptedFilesStatus(repoRoot, service.name)
+		syncStatus := services.GetServiceSyncStatus(repoRoot, service.name, false)
 
-		state, err := services.GetActiveServiceState(serviceDirectory)
+		state, err := services.GetActiveServiceState(serviceDirectory, containers)
 		if err != nil {
 			log.Fatal(err)
 			return
 		}
 
-		var serviceStatus string = services.GetServiceStatusString(state.ServiceState)
-		if state.Label != "" {
-			serviceStatus += " (" + state.Label + ")"
-		}
-
 		// Atomically get the next index
 		idx := atomic.AddInt32(counter, 1) - 1
-		result[idx] = ServiceOutput{dockerStatus: serviceStatus, decryptStatus: decryptStatus, Service: service}
+		healthy, healthChecked := state.HealthCount()
+		result[idx] = ServiceOutput{dockerState: state.ServiceState, dockerStatus: services.GetComposeFileStatusString(state),
+			healthy: healthy, healthChecked: healthChecked, variant: state.Label,
+			decryptStatus: decryptStatus, syncStatus: syncStatus, Service: service}
 	}
 }
 
@@ -72,10 +79,12 @@ func processService(channel <-chan Service, result []ServiceOutput, counter *int
 // the service, so that you can avoid typing the long
 // service name with the -n flag and use -s flag instead.
 // It will show you the status of docker, whether the service
-// is running or not, and the decryption status of the secrets
+// is running or not, the decryption status of the secrets and
+// whether the decrypted secrets are in sync with the encrypted one
 var listCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all services in the self-host repo with status",
+	Use:         "list",
+	Annotations: map[string]string{OUTPUT_STRUCTURED_ANNOTATION: "true"},
+	Short:       "List all services in the self-host repo with status",
 	Example: `  To list all the available service in the repository:
     
 	# using the default repo-path set by 'composectl set'
@@ -83,10 +92,14 @@ var listCmd = &cobra.Command{
 
 	# override the default repo-path
 	composectl list -r ../SelfHostCompose
+
+	# as a json document for scripts
+	composectl list --output json
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := deps.CheckDockerDeps(config.DockerBuildxMajorVersion, config.DockerComposeMajorVersion); err != nil {
 			fmt.Fprintln(os.Stderr, "Error:", err)
+			exitStructuredOutput()
 			return
 		}
 
@@ -100,20 +113,28 @@ var listCmd = &cobra.Command{
 		repoRoot, err := services.ResolveRepoRoot(repoPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			exitStructuredOutput()
 			return
 		}
 
 		serviceList, err := services.ListAllService(repoRoot)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+			exitStructuredOutput()
 			return
 		}
 
-		if len(serviceList) == 0 {
+		// An empty repository is an empty document in the structured output
+		if len(serviceList) == 0 && !isStructuredOutput() {
 			fmt.Fprintln(os.Stderr, "No services found.")
 			return
 		}
 
+		// A single query of the Docker Engine API for every service, each
+		// service falls back to 'docker compose ps' when it fails or has no
+		// container of the repository
+		var containers *services.ComposeContainers = loadComposeContainers(repoRoot)
+
 		var serviceWg sync.WaitGroup
 		var serviceChannel chan Service = make(chan Service)
 
@@ -129,7 +150,7 @@ var listCmd = &cobra.Command{
 			serviceWg.Add(1)
 			go func() {
 				defer serviceWg.Done()
-				processService(serviceChannel, serviceOutput, &atomicCounter, repoRoot)
+				processService(serviceChannel, serviceOutput, &atomicCounter, repoRoot, containers)
 			}()
 		}
 
@@ -144,15 +165,68 @@ var listCmd = &cobra.Command{
 			return serviceOutput[i].sequence < serviceOutput[j].sequence
 		})
 
+		if isStructuredOutput() {
+			var document serviceListDocument = serviceListDocument{SchemaVersion: OUTPUT_SCHEMA_VERSION,
+				Services: make([]serviceSummaryDocument, 0, len(serviceOutput))}
+			for _, result := range serviceOutput {
+				document.Services = append(document.Services, serviceSummaryDocument{
+					Sequence:      result.sequence,
+					Name:          result.name,
+					DockerStatus:  services.GetServiceStatusString(result.dockerState),
+					Healthy:       result.healthy,
+					HealthChecked: result.healthChecked,
+					Variant:       result.variant,
+					Decrypted:     services.GetDecryptedStatusString(result.decryptStatus),
+					Sync:          services.GetSecretSyncStateString(result.syncStatus),
+				})
+			}
+
+			if err := printStructured(document); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing the output: %v\n", err)
+				exitStructuredOutput()
+			}
+			return
+		}
+
 		// Print final results
 		for _, result := range serviceOutput {
-			fmt.Printf("%2d - %-23s  Status: %-16s  Decrypted: %-6s\n",
-				result.sequence, result.name, result.dockerStatus, services.GetDecryptedStatusString(result.decryptStatus))
+			var serviceStatus string = result.dockerStatus
+			if result.variant != "" {
+				serviceStatus += " (" + result.variant + ")"
+			}
+
+			fmt.Printf("%2d - %-23s  Status: %-28s  Decrypted: %-7s  Sync: %-8s\n",
+				result.sequence, result.name, serviceStatus, services.GetDecryptedStatusString(result.decryptStatus),
+				services.GetSecretSyncStateString(result.syncStatus))
 		}
 		fmt.Print("\n")
 	},
 }
 
+// loadComposeContainers returns a snapshot of the compose containers from
+// the Docker Engine API, or nil when the daemon can't be queried or has no
+// container of the services of the repository, so that the state is read
+// with 'docker compose ps' instead
+func loadComposeContainers(repoRoot string) *services.ComposeContainers {
+	dockerClient, err := deps.NewDockerClient()
+	if err != nil {
+		return nil
+	}
+	defer dockerClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	containers, err := services.LoadComposeContainers(dockerClient, ctx)
+	if err != nil {
+		return nil
+	}
+	if !containers.HasProjectsIn(filepath.Join(repoRoot, config.DockerServicesDir)) {
+		return nil
+	}
+	return containers
+}
+
 func init() {
 	RootCmd.AddCommand(listCmd)
 }
@@ -0,0 +1,182 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// The formats of the global --output flag
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+	OUTPUT_YAML  = "yaml"
+)
+
+// The version of the schema of the structured output. The fields and the
+// status values of the documents are only ever added to within a version,
+// a breaking change increments it.
+const OUTPUT_SCHEMA_VERSION = 1
+
+// The annotation of the commands that support the structured output
+const OUTPUT_STRUCTURED_ANNOTATION = "structured-output"
+
+// The output format of the commands that support structured output
+var outputFormat string
+
+// validateOutputFormat checks the value of the global --output flag
+func validateOutputFormat() error {
+	switch outputFormat {
+	case OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_YAML:
+		return nil
+	default:
+		return fmt.Errorf("invalid output format %q, expected %s, %s or %s", outputFormat,
+			OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_YAML)
+	}
+}
+
+// checkStructuredOutput checks that the command supports the output
+// format, only the commands annotated with OUTPUT_STRUCTURED_ANNOTATION
+// print a json or yaml document
+func checkStructuredOutput(cmd *cobra.Command) error {
+	if !isStructuredOutput() {
+		return nil
+	}
+	if _, ok := cmd.Annotations[OUTPUT_STRUCTURED_ANNOTATION]; ok {
+		return nil
+	}
+	return fmt.Errorf("'%s' doesn't support the %s output format, only list, service and config do",
+		cmd.CommandPath(), outputFormat)
+}
+
+// exitStructuredOutput exits with a non-zero status when the command
+// failed without printing its json or yaml document, so that scripts
+// don't mistake the empty output for a success
+func exitStructuredOutput() {
+	if isStructuredOutput() {
+		os.Exit(1)
+	}
+}
+
+// isStructuredOutput reports whether the output is a json or yaml document
+func isStructuredOutput() bool {
+	return outputFormat == OUTPUT_JSON || outputFormat == OUTPUT_YAML
+}
+
+// printStructured writes the document to stdout in the output format
+func printStructured(document any) error {
+	switch outputFormat {
+	case OUTPUT_JSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(document)
+	case OUTPUT_YAML:
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(document); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("the %s output format is not a structured format", outputFormat)
+	}
+}
+
+// The document of 'composectl list'
+type serviceListDocument struct {
+	SchemaVersion int                      `json:"schema_version" yaml:"schema_version"`
+	Services      []serviceSummaryDocument `json:"services" yaml:"services"`
+}
+
+// The status of a service in 'composectl list'
+type serviceSummaryDocument struct {
+	Sequence int    `json:"sequence" yaml:"sequence"`
+	Name     string `json:"name" yaml:"name"`
+	// The docker status of the active compose file: Running, Partial,
+	// Restarting, Degraded, Failed, Stopped, Created, Paused, Dead or Unused
+	DockerStatus string `json:"docker_status" yaml:"docker_status"`
+	// The healthy containers and the containers with a health check
+	Healthy       int `json:"healthy" yaml:"healthy"`
+	HealthChecked int `json:"health_checked" yaml:"health_checked"`
+	// The variant of the active compose file, empty for compose.yml
+	Variant   string `json:"variant" yaml:"variant"`
+	Decrypted string `json:"decrypted" yaml:"decrypted"`
+	Sync      string `json:"sync" yaml:"sync"`
+}
+
+// The document of 'composectl service'
+type serviceDocument struct {
+	SchemaVersion int                   `json:"schema_version" yaml:"schema_version"`
+	Sequence      int                   `json:"sequence" yaml:"sequence"`
+	Name          string                `json:"name" yaml:"name"`
+	Decrypted     string                `json:"decrypted" yaml:"decrypted"`
+	Sync          string                `json:"sync" yaml:"sync"`
+	ComposeFiles  []composeFileDocument `json:"compose_files" yaml:"compose_files"`
+	Files         []serviceFileDocument `json:"files" yaml:"files"`
+}
+
+// The docker status of a compose file of a service
+type composeFileDocument struct {
+	File          string              `json:"file" yaml:"file"`
+	Variant       string              `json:"variant" yaml:"variant"`
+	DockerStatus  string              `json:"docker_status" yaml:"docker_status"`
+	Healthy       int                 `json:"healthy" yaml:"healthy"`
+	HealthChecked int                 `json:"health_checked" yaml:"health_checked"`
+	Containers    []containerDocument `json:"containers" yaml:"containers"`
+}
+
+// A container of a compose file
+type containerDocument struct {
+	Name    string `json:"name" yaml:"name"`
+	Service string `json:"service" yaml:"service"`
+	State   string `json:"state" yaml:"state"`
+	// The health check status, empty without a health check
+	Health   string `json:"health" yaml:"health"`
+	ExitCode int    `json:"exit_code" yaml:"exit_code"`
+}
+
+// A file of a service
+type serviceFileDocument struct {
+	Filename            string `json:"filename" yaml:"filename"`
+	IsSecret            bool   `json:"is_secret" yaml:"is_secret"`
+	HasDecryptedVersion bool   `json:"has_decrypted_version" yaml:"has_decrypted_version"`
+	// The sync state of the decrypted version, empty without one
+	Sync string `json:"sync" yaml:"sync"`
+}
+
+// The document of 'composectl config'
+type configDocument struct {
+	SchemaVersion    int                 `json:"schema_version" yaml:"schema_version"`
+	RepoPath         string              `json:"repo_path" yaml:"repo_path"`
+	AgePubkeys       []string            `json:"age_pubkeys" yaml:"age_pubkeys"`
+	SecretPatterns   []string            `json:"secret_patterns" yaml:"secret_patterns"`
+	SecretMaxAgeDays int                 `json:"secret_max_age_days" yaml:"secret_max_age_days"`
+	Vault            vaultConfigDocument `json:"vault" yaml:"vault"`
+	S3Bucket         string              `json:"s3_bucket" yaml:"s3_bucket"`
+}
+
+// The Vault configuration of 'composectl config'
+type vaultConfigDocument struct {
+	Address     string `json:"address" yaml:"address"`
+	TokenSource string `json:"token_source" yaml:"token_source"`
+	TransitKey  string `json:"transit_key" yaml:"transit_key"`
+}
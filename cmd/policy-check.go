@@ -0,0 +1,149 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command checks that every secret is encrypted to
+// exactly the recipients allowed by the secrets policy.
+// It exits with 1 on any violation, so that it can be
+// used in CI
+var policyCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the recipients of the secrets against the secrets policy",
+	Long: `Check that the secrets of a service, or of every service when no
+	service is specified, are encrypted to exactly the recipients
+	allowed by the repository secrets-policy.yaml.
+
+	The recipients are age or SSH public keys, the names of the
+	members of the team manifest, or the other sops master keys:
+	PGP fingerprints, AWS KMS ARNs, Vault transit URIs, GCP KMS
+	resource IDs and Azure Key Vault key URLs. A secret encrypted to
+	a master key that isn't listed violates the policy. The same check
+	is enforced by encrypt, sync, rekey, team and the git merge
+	driver. The first service policy matching
+	the service that sets recipients applies, and the services
+	without one can be decrypted by any recipient:
+
+	  services:
+	    - match: payment-*
+	      recipients:
+	        - alice
+	        - age1...
+
+	The command exits with 1 when any secret has a recipient that
+	is not allowed, or is missing an allowed recipient. Run
+	'composectl rekey --recipients' to fix the recipients.`,
+	Example: `  Check the recipients of the secrets:
+
+  # every service in the repository
+  composectl policy check
+
+  # by service name
+  composectl policy check -n payment-gateway
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			os.Exit(1)
+		}
+
+		var serviceNames []string
+		if name != "" || sequence > 0 {
+			serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+
+			if serviceLists == nil && err == nil {
+				os.Exit(1)
+			}
+			serviceNames = []string{name}
+		} else {
+			serviceNames, err = services.ListAllService(repoRoot)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		policy, err := services.LoadSecretsPolicy(repoRoot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if !policy.HasRecipientsPolicy() {
+			fmt.Printf("The %s of the repository doesn't restrict the recipients of any service\n", config.SecretsPolicyFile)
+			return
+		}
+
+		results, err := services.CheckRecipientsPolicy(repoRoot, serviceNames, policy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to check the recipients of the secrets: %v\n", err)
+			os.Exit(1)
+		}
+
+		var violations int = 0
+		for _, result := range results {
+			var status string = "OK"
+			if len(result.Missing) > 0 || len(result.Extra) > 0 {
+				status = "VIOLATION"
+				violations++
+			}
+
+			fmt.Printf("%-9s  %s\n", status, filepath.Join(result.Service, result.File.Filename))
+			for _, recipient := range result.Missing {
+				fmt.Printf("             missing: %s\n", recipient)
+			}
+			for _, recipient := range result.Extra {
+				fmt.Printf("             not allowed: %s\n", recipient)
+			}
+		}
+
+		fmt.Printf("\n%d secrets checked, %d violations\n", len(results), violations)
+		if violations > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	policyCmd.AddCommand(policyCheckCmd)
+	policyCheckCmd.Flags().StringP("name", "n", "", "The name of the service (default to all services)")
+	policyCheckCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service (default to all services)")
+}
@@ -0,0 +1,219 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command re-encrypts the secrets to a new set of age
+// recipients, for example when a member leaves the team.
+// The data key of every file is rotated as well, so that a
+// removed recipient that has kept an old data key can't
+// decrypt the new content.
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Re-encrypt the secrets to a new set of recipients and rotate the data keys",
+	Long: `Re-encrypt the secrets of a service, or of every service when
+	no service is specified, to a new set of age recipients.
+
+	The recipients are taken from the --recipients flag, then the
+	matching creation rule of the repository .sops.yaml, then the
+	age public key set with 'composectl set'. The recipients are
+	age public keys or ssh-ed25519 and ssh-rsa public keys.
+
+	The HashiCorp Vault transit keys are taken from the
+	--hc-vault-transit flag, then the 'vault-transit-key' config.
+	When neither is set, the Vault transit keys of the secrets
+	are left untouched.
+
+	A summary of the affected files is always printed first. Each
+	file is replaced atomically, a failed file is left untouched.`,
+	Example: `  Rekey the secrets:
+
+  # show the files that would be changed
+  composectl rekey --dry-run
+
+  # every service in the repository
+  composectl rekey
+
+  # a single service to an explicit recipient set
+  composectl rekey -n gitea --recipients age1...,age1...
+
+  # to an SSH public key, which age accepts as a recipient
+  composectl rekey -n gitea --recipients "age1...,ssh-ed25519 AAAA..."
+
+  # to a Vault transit key in addition to the age recipients
+  composectl rekey -n gitea --hc-vault-transit transit/keys/sops
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+
+		recipientsFlag, _ := cmd.Flags().GetString("recipients")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		vaultKeys, _ := cmd.Flags().GetString("hc-vault-transit")
+
+		if err := checkSops(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		var serviceNames []string
+		if name != "" || sequence > 0 {
+			serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				return
+			}
+
+			if serviceLists == nil && err == nil {
+				return
+			}
+			serviceNames = []string{name}
+		} else {
+			serviceNames, err = services.ListAllService(repoRoot)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+				return
+			}
+		}
+
+		services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+		var defaultRecipients []string = services.SplitRecipients(viper.GetString(CONFIG_AGE_PUBKEY))
+
+		var recipients []string = services.SplitRecipients(recipientsFlag)
+		for _, recipient := range recipients {
+			if err := services.ValidateAgeRecipient(recipient); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return
+			}
+		}
+
+		vaultUris, err := resolveVaultTransitUris(vaultKeys)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to use the Vault transit key: %v\n", err)
+			return
+		}
+
+		plans, err := services.PlanRekey(repoRoot, serviceNames, recipients, defaultRecipients, vaultUris)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to plan the rekey: %v\n", err)
+			return
+		}
+
+		if len(plans) == 0 {
+			fmt.Println("No secrets to rekey")
+			return
+		}
+
+		fmt.Printf("%d secrets will be re-encrypted with a rotated data key:\n", len(plans))
+		for _, plan := range plans {
+			fmt.Printf("  %s\n", filepath.Join(plan.Service, plan.File.Filename))
+			for _, recipient := range plan.AddRecipients {
+				fmt.Printf("      + %s\n", recipient)
+			}
+			for _, recipient := range plan.RemoveRecipients {
+				fmt.Printf("      - %s\n", recipient)
+			}
+			for _, uri := range plan.AddHcVaultTransitUris {
+				fmt.Printf("      + %s\n", uri)
+			}
+			for _, uri := range plan.RemoveHcVaultTransitUris {
+				fmt.Printf("      - %s\n", uri)
+			}
+		}
+		fmt.Print("\n")
+
+		team, err := services.LoadTeamManifest(repoRoot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		if err := services.CheckRekeyPolicy(repoRoot, plans, team); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		if dryRun {
+			return
+		}
+
+		if err := checkPlansIdentity(repoRoot, plans); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		var failed []string
+		for _, plan := range plans {
+			if err := services.RekeyFile(repoRoot, plan); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				failed = append(failed, filepath.Join(plan.Service, plan.File.Filename))
+				continue
+			}
+			fmt.Printf("Rekeyed %s\n", filepath.Join(plan.Service, plan.File.Filename))
+		}
+
+		if len(failed) > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d of %d secrets failed to rekey:\n  %s\n",
+				len(failed), len(plans), strings.Join(failed, "\n  "))
+			os.Exit(1)
+		}
+	},
+}
+
+// checkPlansIdentity checks that sops can decrypt every planned file, with
+// an age identity or with Vault for the files encrypted to a transit key
+func checkPlansIdentity(repoRoot string, plans []services.RekeyPlan) error {
+	for _, plan := range plans {
+		var encryptedFilePath string = filepath.Join(repoRoot, config.DockerServicesDir, plan.Service, plan.File.Filename)
+		if err := services.CheckDecryptIdentity(encryptedFilePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(rekeyCmd)
+	rekeyCmd.Flags().StringP("name", "n", "", "The name of the service (default to all services)")
+	rekeyCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service (default to all services)")
+	rekeyCmd.Flags().String("recipients", "", "Comma separated age or SSH public keys to rekey to")
+	rekeyCmd.Flags().String("hc-vault-transit", "", "Comma separated Vault transit keys to rekey to, e.g. transit/keys/sops")
+	rekeyCmd.Flags().Bool("dry-run", false, "Only show the secrets that would be rekeyed")
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -41,6 +42,16 @@ of each service and prompt you whenever there is a missing secret.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputFormat(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if err := checkStructuredOutput(cmd); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -59,4 +70,6 @@ func init() {
 
 	// RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.composectl.yaml)")
 	RootCmd.PersistentFlags().StringVarP(&repoPath, CONFIG_REPO_PATH, "r", "", "Path to selfhost repo (overrides default location)")
+	RootCmd.PersistentFlags().StringVar(&outputFormat, "output", OUTPUT_TABLE,
+		"The output format: table, or json and yaml for list, service and config")
 }
@@ -0,0 +1,189 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command reports how long ago each secret was last
+// changed, so that the credentials can be rotated before
+// they exceed the maximum age required by a compliance
+// policy. It exits with 1 when any secret is too old, so
+// that it can be used for monitoring
+var secretsAgeCmd = &cobra.Command{
+	Use:   "age",
+	Short: "Report the secrets that were not changed for longer than the maximum age",
+	Long: `Report how long ago each secret was last changed, of a service
+	or of every service when no service is specified.
+
+	The time of the last change is the lastmodified field of the
+	sops metadata, which sops updates on every change, or the last
+	commit of the encrypted file when the metadata can't be read.
+	The age of a secret is Unknown when neither is available.
+
+	The lastmodified field is also updated when the secret is
+	re-encrypted without changing its credentials, by 'composectl
+	rekey', 'composectl team', the git merge driver and 'composectl
+	secrets fix-eol'. With --history, the git history of every
+	secret is decrypted to find the last commit that changed its
+	credentials instead, which requires the private key and runs
+	sops once per commit.
+
+	The maximum age in days is taken from the matching service of
+	the repository secrets-policy.yaml, then its max_age_days,
+	then the --max-age flag or the secret-max-age config set with
+	'composectl set', then 180 days:
+
+	  max_age_days: 180
+	  services:
+	    - match: payment-*
+	      max_age_days: 90
+
+	The command exits with 1 when any secret is older than its
+	maximum age.`,
+	Example: `  Report the age of the secrets:
+
+  # every service in the repository
+  composectl secrets age
+
+  # only the secrets that are too old
+  composectl secrets age --expired
+
+  # by service name with a maximum age of 90 days
+  composectl secrets age -n gitea --max-age 90
+
+  # ignoring the commits that only re-encrypted the secrets
+  composectl secrets age --history
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+		maxAge, _ := cmd.Flags().GetInt("max-age")
+		expiredOnly, _ := cmd.Flags().GetBool("expired")
+		history, _ := cmd.Flags().GetBool("history")
+
+		if history {
+			if err := checkSops(); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+		}
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			os.Exit(1)
+		}
+
+		var serviceNames []string
+		if name != "" || sequence > 0 {
+			serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+
+			if serviceLists == nil && err == nil {
+				os.Exit(1)
+			}
+			serviceNames = []string{name}
+		} else {
+			serviceNames, err = services.ListAllService(repoRoot)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if maxAge <= 0 {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			maxAge = viper.GetInt(CONFIG_SECRET_MAX_AGE)
+		}
+		if maxAge <= 0 {
+			maxAge = services.DefaultSecretMaxAgeDays
+		}
+
+		policy, err := services.LoadSecretsPolicy(repoRoot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		ages, err := services.GetSecretAges(repoRoot, serviceNames, policy, maxAge, time.Now(), history)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to determine the age of the secrets: %v\n", err)
+			os.Exit(1)
+		}
+
+		var expired, unknown int = 0, 0
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "SERVICE\tSECRET\tLAST CHANGED\tSOURCE\tAGE\tMAX AGE\tSTATUS")
+		for _, age := range ages {
+			var status, lastChanged, ageDays string = "OK", "-", "-"
+			switch {
+			case age.LastChanged.IsZero():
+				status = "Unknown"
+				unknown++
+			case age.Expired:
+				status = "Expired"
+				expired++
+			}
+
+			if expiredOnly && !age.Expired {
+				continue
+			}
+			if !age.LastChanged.IsZero() {
+				lastChanged = age.LastChanged.Local().Format(time.DateOnly)
+				ageDays = fmt.Sprintf("%dd", age.AgeDays)
+			}
+
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%dd\t%s\n", age.Service, age.File.Filename,
+				lastChanged, orDefault(age.Source, "-"), ageDays, age.MaxAgeDays, status)
+		}
+		writer.Flush()
+
+		fmt.Printf("\n%d secrets, %d expired, %d unknown\n", len(ages), expired, unknown)
+		if expired > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsAgeCmd)
+	secretsAgeCmd.Flags().StringP("name", "n", "", "The name of the service (default to all services)")
+	secretsAgeCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service (default to all services)")
+	secretsAgeCmd.Flags().Int("max-age", 0, "The maximum age in days of the secrets without a policy (default to the secret-max-age config or 180)")
+	secretsAgeCmd.Flags().Bool("expired", false, "Only show the secrets older than their maximum age")
+	secretsAgeCmd.Flags().Bool("history", false, "Decrypt the git history to ignore the commits that only re-encrypted the secrets")
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command rewrites the encrypted files that have CRLF
+// or mixed line endings, usually converted by git on Windows,
+// with LF line endings as written by sops
+var secretsFixEolCmd = &cobra.Command{
+	Use:   "fix-eol",
+	Short: "Rewrite the encrypted secrets with CRLF or mixed line endings to LF",
+	Long: `Rewrite the encrypted secrets with CRLF or mixed line endings
+	to LF, of a service or of every service when no service is
+	specified.
+
+	sops always writes LF line endings, a CRLF encrypted file is
+	usually converted by git on a Windows checkout. To stop git
+	from converting them, add the following to .gitattributes:
+
+	  *.enc -text
+	  *.enc.* -text`,
+	Example: `  Fix the line endings of the encrypted secrets:
+
+  # every service in the repository
+  composectl secrets fix-eol
+
+  # only report the affected files, exit with 1 if any
+  composectl secrets fix-eol --check
+
+  # by service name (as per 'composectl list')
+  composectl secrets fix-eol -n gitea
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+		check, _ := cmd.Flags().GetBool("check")
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			os.Exit(1)
+		}
+
+		var serviceNames []string
+		if name != "" || sequence > 0 {
+			serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+
+			if serviceLists == nil && err == nil {
+				os.Exit(1)
+			}
+			serviceNames = []string{name}
+		} else {
+			serviceNames, err = services.ListAllService(repoRoot)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		issues, err := services.FindLineEndingIssues(repoRoot, serviceNames)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+
+		if len(issues) == 0 {
+			fmt.Println("All encrypted secrets have LF line endings")
+			return
+		}
+
+		var failed int = 0
+		for _, issue := range issues {
+			var relativePath string = filepath.Join(issue.Service, issue.File.Filename)
+			if check {
+				fmt.Printf("%s has %s line endings\n", relativePath, services.GetLineEndingString(issue.LineEnding))
+				continue
+			}
+
+			if err := services.FixLineEnding(filepath.Join(repoRoot, config.DockerServicesDir, relativePath)); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				failed++
+				continue
+			}
+			fmt.Printf("Converted %s from %s to LF line endings\n", relativePath, services.GetLineEndingString(issue.LineEnding))
+		}
+
+		if check || failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsFixEolCmd)
+	secretsFixEolCmd.Flags().StringP("name", "n", "", "The name of the service (default to all services)")
+	secretsFixEolCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service (default to all services)")
+	secretsFixEolCmd.Flags().Bool("check", false, "Only report the secrets with CRLF or mixed line endings")
+}
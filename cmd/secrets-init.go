@@ -0,0 +1,166 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command creates a new dotenv secret of a service from
+// a template, such as .env.example, filling every empty value
+// with a generated secret. The result is encrypted right away
+var secretsInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a dotenv secret from a template with generated values and encrypt it",
+	Long: `Create a dotenv secret from a template, such as .env.example.
+
+	Every key with an empty value is filled with a random value
+	of the given length and charset, the values already set in
+	the template are kept. The charset is alnum, hex, urlsafe
+	(the url safe base64 alphabet, also named base64) or the
+	characters to pick from, except a single quote. A generated
+	value with characters outside of urlsafe is single quoted.
+
+	The secret is written next to the template without the
+	.example suffix, then encrypted the same way as
+	'composectl encrypt'.`,
+	Example: `  Create a dotenv secret from a template:
+
+  # .env from .env.example, relative to the service root
+  composectl secrets init -n gitea --from .env.example
+
+  # with 64 hex characters for the generated values
+  composectl secrets init -n gitea --from .env.example --length 64 --charset hex
+
+  # to overwrite the existing secret
+  composectl secrets init -n gitea --from .env.example -o
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+
+		from, _ := cmd.Flags().GetString("from")
+		length, _ := cmd.Flags().GetInt("length")
+		charset, _ := cmd.Flags().GetString("charset")
+		publicKey, _ := cmd.Flags().GetString("pubkey")
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+
+		if name == "" && sequence <= 0 {
+			fmt.Fprintln(os.Stderr, "Either the service name or sequence must be specified correctly!")
+			return
+		}
+
+		if !strings.HasSuffix(from, services.TemplateSuffix) {
+			fmt.Fprintf(os.Stderr, "The template must end with %s, e.g. .env%s\n", services.TemplateSuffix, services.TemplateSuffix)
+			return
+		}
+
+		if err := checkSops(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		if serviceLists == nil && err == nil {
+			return
+		}
+
+		var templatePath string = filepath.Join(repoRoot, config.DockerServicesDir, name, from)
+		var targetFile string = strings.TrimSuffix(templatePath, services.TemplateSuffix)
+
+		for _, path := range []string{targetFile, targetFile + ".enc"} {
+			if _, err := os.Stat(path); err == nil && !overwrite {
+				fmt.Fprintf(os.Stderr, "%s already exists, specify -o to overwrite it\n", path)
+				return
+			}
+		}
+
+		template, err := os.ReadFile(templatePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read the template: %v\n", err)
+			return
+		}
+
+		content, generated, err := services.FillEnvTemplate(template, length, charset)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		vaultUris, err := resolveVaultTransitUris("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to use the Vault transit key: %v\n", err)
+			return
+		}
+
+		options, err := resolveEncryptOptions(repoRoot, name, targetFile, publicKey, vaultUris)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurred while resolving the recipients: %v\n", err)
+			return
+		}
+		options.Overwrite = overwrite
+
+		if err := os.WriteFile(targetFile, content, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write to file: %v\n", err)
+			return
+		}
+		fmt.Printf("Generated %d values in %s: %s\n", len(generated), targetFile, strings.Join(generated, ", "))
+
+		if err := services.EncryptFile(targetFile, options); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+	},
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsInitCmd)
+	secretsInitCmd.Flags().StringP("name", "n", "", "The name of the service")
+	secretsInitCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service")
+	secretsInitCmd.Flags().String("from", "", "The dotenv template relative to the service root, e.g. .env.example")
+	secretsInitCmd.Flags().Int("length", 32, "The length of the generated values")
+	secretsInitCmd.Flags().String("charset", "alnum", "The charset of the generated values (alnum|hex|urlsafe|base64 or the characters to use)")
+	secretsInitCmd.Flags().StringP("pubkey", "p", "", "The comma separated age public keys to encrypt the secret")
+	secretsInitCmd.Flags().BoolP("overwrite", "o", false, "Whether to overwrite the secret if it already exists")
+	secretsInitCmd.MarkFlagRequired("from")
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command lists who can decrypt each secret by reading the
+// sops metadata of the encrypted files, without decrypting them.
+// It flags the secrets whose recipients differ from the configured
+// recipients, and the secrets that the current user can't decrypt.
+var secretsRecipientsCmd = &cobra.Command{
+	Use:   "recipients",
+	Short: "Show the recipients that can decrypt each secret",
+	Long: `Show the age, PGP, KMS and Vault recipients, the last modified time
+	and the MAC presence of each secret by reading its sops metadata.
+
+	A secret is flagged when its age recipients differ from the
+	matching creation rule of the repository .sops.yaml (or the
+	age public key set with 'composectl set'), or when none of
+	the identities in your keys.txt is a recipient.
+
+	The command exits with a non-zero code when any secret is flagged
+	or its sops metadata can't be read.`,
+	Example: `  Audit the recipients of the secrets:
+
+  # every service in the repository
+  composectl secrets recipients
+
+  # a single service by name (as per 'composectl list')
+  composectl secrets recipients -n gitea
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		var serviceNames []string
+		if name != "" || sequence > 0 {
+			serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				return
+			}
+
+			if serviceLists == nil && err == nil {
+				return
+			}
+			serviceNames = []string{name}
+		} else {
+			serviceNames, err = services.ListAllService(repoRoot)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+				return
+			}
+		}
+
+		services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+		var defaultRecipients []string = services.SplitRecipients(viper.GetString(CONFIG_AGE_PUBKEY))
+
+		identities, err := services.GetPublicKeysFromDefaultLocation()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: unable to read your age identities: %v\n", err)
+		}
+
+		results, err := services.GetSecretRecipients(repoRoot, serviceNames, defaultRecipients, identities)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read the secrets recipients: %v\n", err)
+			return
+		}
+
+		var flaggedCount int = 0
+		for _, result := range results {
+			fmt.Println(filepath.Join(result.Service, result.File.Filename))
+			if result.Err != nil {
+				fmt.Printf("  ! unable to read the sops metadata: %v\n", result.Err)
+				flaggedCount++
+				continue
+			}
+			fmt.Printf("  Age:            %s\n", orDefault(strings.Join(result.Metadata.AgeRecipients, ", "), "-"))
+			fmt.Printf("  PGP:            %s\n", orDefault(strings.Join(result.Metadata.PgpFingerprints, ", "), "-"))
+			fmt.Printf("  KMS:            %s\n", orDefault(strings.Join(result.Metadata.KmsArns, ", "), "-"))
+			fmt.Printf("  Vault:          %s\n", orDefault(strings.Join(result.Metadata.HcVaultTransitUris, ", "), "-"))
+
+			var lastModified string = "-"
+			if !result.Metadata.LastModified.IsZero() {
+				lastModified = result.Metadata.LastModified.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("  Last modified:  %s\n", lastModified)
+			if result.Metadata.Mac != "" {
+				fmt.Println("  MAC:            present")
+			} else {
+				fmt.Println("  MAC:            missing")
+			}
+
+			var flagged bool = false
+			for _, recipient := range result.Missing {
+				fmt.Printf("  ! missing configured recipient %s\n", recipient)
+				flagged = true
+			}
+			for _, recipient := range result.Extra {
+				fmt.Printf("  ! unexpected recipient %s\n", recipient)
+				flagged = true
+			}
+			if len(identities) > 0 && !result.CanDecrypt {
+				fmt.Println("  ! none of your age identities can decrypt this secret")
+				flagged = true
+			}
+			if result.Metadata.Mac == "" {
+				flagged = true
+			}
+
+			if flagged {
+				flaggedCount++
+			}
+		}
+
+		if flaggedCount > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d of %d secrets flagged\n", flaggedCount, len(results))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsRecipientsCmd)
+	secretsRecipientsCmd.Flags().StringP("name", "n", "", "The name of the service (default to all services)")
+	secretsRecipientsCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service (default to all services)")
+}
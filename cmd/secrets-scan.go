@@ -0,0 +1,93 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command scans the repository for plaintext secrets that
+// are staged or tracked by git. It is run by the pre-commit hook
+// installed with 'composectl hooks install'.
+var secretsScanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Scan the staged or tracked files for plaintext secrets",
+	Long: `Scan the staged or tracked files for plaintext secrets.
+
+	The scan fails when the decrypted counterpart of any encrypted
+	secret is staged (or tracked), or is not git ignored. It also
+	fails when a well-known credential format or a high entropy
+	string is found in a non-encrypted file under docker_services.
+
+	A line containing "composectl:ignore" is never reported.`,
+	Example: `  Scan for plaintext secrets:
+
+  # the files staged for commit
+  composectl secrets scan --staged
+
+  # every file tracked by git
+  composectl secrets scan
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		staged, _ := cmd.Flags().GetBool("staged")
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			os.Exit(1)
+		}
+
+		findings, err := services.ScanSecrets(repoRoot, staged)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to scan for secrets: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(findings) == 0 {
+			fmt.Println("No plaintext secrets found")
+			return
+		}
+
+		for _, finding := range findings {
+			if finding.Line > 0 {
+				fmt.Fprintf(os.Stderr, "%s:%d: %s [%s]\n", finding.Path, finding.Line, finding.Message, finding.Rule)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s [%s]\n", finding.Path, finding.Message, finding.Rule)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "\n%d potential plaintext secrets found\n", len(findings))
+		os.Exit(1)
+	},
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsScanCmd)
+	secretsScanCmd.Flags().Bool("staged", false, "Only scan the files staged for commit")
+}
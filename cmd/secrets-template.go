@@ -0,0 +1,124 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command writes a template of every encrypted dotenv
+// secret of a service, e.g. .env.example for .env.enc, with
+// the keys of the secret and the values removed. The key
+// names are read from the encrypted file, so no private key
+// is needed
+var secretsTemplateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Write a .env.example with the keys of the encrypted dotenv secrets",
+	Example: `  Write the dotenv templates of a service:
+
+  # by service name (as per 'composectl list')
+  composectl secrets template -n gitea
+
+  # to overwrite the existing templates
+  composectl secrets template -n gitea -o
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+
+		if name == "" && sequence <= 0 {
+			fmt.Fprintln(os.Stderr, "Either the service name or sequence must be specified correctly!")
+			return
+		}
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		if serviceLists == nil && err == nil {
+			return
+		}
+
+		files, err := services.ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error resolving service's details: %v\n", err)
+			return
+		}
+
+		var written int = 0
+		for _, file := range files {
+			var encryptedFilePath string = filepath.Join(repoRoot, config.DockerServicesDir, name, file.Filename)
+			if services.GetEncryptedFileType(encryptedFilePath) != "dotenv" {
+				continue
+			}
+
+			var templatePath string = services.DecryptedFilePath(repoRoot, name, file) + services.TemplateSuffix
+			if _, err := os.Stat(templatePath); err == nil && !overwrite {
+				fmt.Fprintf(os.Stderr, "%s already exists, specify -o to overwrite it\n", templatePath)
+				continue
+			}
+
+			template, err := services.GenerateEnvTemplate(encryptedFilePath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				continue
+			}
+
+			if err := os.WriteFile(templatePath, template, 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write to file: %v\n", err)
+				continue
+			}
+
+			fmt.Printf("Template %s written\n", templatePath)
+			written++
+		}
+
+		if written == 0 {
+			fmt.Fprintln(os.Stderr, "No dotenv template written")
+		}
+	},
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsTemplateCmd)
+	secretsTemplateCmd.Flags().StringP("name", "n", "", "The name of the service")
+	secretsTemplateCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service")
+	secretsTemplateCmd.Flags().BoolP("overwrite", "o", false, "Whether to overwrite the template if it already exists")
+}
@@ -33,8 +33,9 @@ import (
 // all secrets of the service by index, and optionally
 // all the files of the service
 var serviceCmd = &cobra.Command{
-	Use:   "service",
-	Short: "Show the details of the specified service",
+	Use:         "service",
+	Annotations: map[string]string{OUTPUT_STRUCTURED_ANNOTATION: "true"},
+	Short:       "Show the details of the specified service",
 	Example: `  To show the details of a service:
     
 	# by service sequence (as per 'composectl list')
@@ -42,6 +43,9 @@ var serviceCmd = &cobra.Command{
 
 	# by service name (as per 'composectl list')
 	composectl service -n gitea -a
+
+	# as a yaml document for scripts
+	composectl service -n gitea --output yaml
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		name, _ := cmd.Flags().GetString("name")
@@ -50,14 +54,19 @@ var serviceCmd = &cobra.Command{
 
 		if name == "" && sequence <= 0 {
 			fmt.Fprintln(os.Stderr, "Either the service name or sequence must be specified correctly!")
+			exitStructuredOutput()
 			return
 		}
 
 		if err := deps.CheckDockerDeps(config.DockerBuildxMajorVersion, config.DockerComposeMajorVersion); err != nil {
 			fmt.Fprintln(os.Stderr, "Error:", err)
+			exitStructuredOutput()
 			return
 		}
 
+		// The sync status decrypts the secrets with sops
+		exportVaultEnv()
+
 		if repoPath == "" {
 			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
 			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
@@ -68,16 +77,33 @@ var serviceCmd = &cobra.Command{
 		repoRoot, err := services.ResolveRepoRoot(repoPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			exitStructuredOutput()
 			return
 		}
 
 		serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
+			exitStructuredOutput()
 			return
 		}
 
 		if serviceLists == nil && err == nil {
+			exitStructuredOutput()
+			return
+		}
+
+		if isStructuredOutput() {
+			document, err := buildServiceDocument(repoRoot, name, sequence, includeAllFiles, loadComposeContainers(repoRoot))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error resolving service's details: %v\n", err)
+				exitStructuredOutput()
+				return
+			}
+			if err := printStructured(document); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing the output: %v\n", err)
+				exitStructuredOutput()
+			}
 			return
 		}
 
@@ -89,15 +115,30 @@ var serviceCmd = &cobra.Command{
 		decryptStatus := services.GetDecryptedFilesStatus(repoRoot, name)
 
 		var serviceDirectory string = filepath.Join(repoRoot, config.DockerServicesDir, name)
-		states, err := services.GetAllServiceState(serviceDirectory)
+		states, err := services.GetAllServiceState(serviceDirectory, loadComposeContainers(repoRoot))
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 		}
 
-		fmt.Printf("Decryption status: %s\n\n", services.GetDecryptedStatusString(decryptStatus))
+		fmt.Printf("Decryption status: %s\n", services.GetDecryptedStatusString(decryptStatus))
+		fmt.Printf("Sync status: %s\n\n", services.GetSecretSyncStateString(services.GetServiceSyncStatus(repoRoot, name, true)))
 		for _, state := range states {
 			fmt.Printf("%s:\n", state.File)
-			fmt.Printf("Docker status: %s\n\n", services.GetServiceStatusString(state.ServiceState))
+			fmt.Printf("Docker status: %s\n", services.GetComposeFileStatusString(state))
+			for _, container := range state.Containers {
+				fmt.Printf("  - %s: %s\n", container.Name, describeContainer(container))
+			}
+			fmt.Print("\n")
+		}
+
+		if report, err := services.CheckServiceReferences(repoRoot, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking the compose references: %v\n", err)
+		} else if report.HasIssues() {
+			fmt.Println("Compose references issues (as per 'composectl check'):")
+			printReferenceIssues(report)
+			fmt.Print("\n")
+		} else {
+			fmt.Print("Compose references: OK\n\n")
 		}
 
 		// List files
@@ -122,13 +163,74 @@ var serviceCmd = &cobra.Command{
 			}
 
 			if file.HasDecryptedVersion {
-				fmt.Printf(" (has decrypted version)")
+				syncState, _ := services.GetSecretSyncState(repoRoot, name, file)
+				fmt.Printf(" (has decrypted version, %s)", services.GetSecretSyncStateString(syncState))
 			}
 			fmt.Print("\n")
 		}
 	},
 }
 
+// buildServiceDocument returns the details of the service shown by
+// 'composectl service' as a structured document
+func buildServiceDocument(repoRoot string, name string, sequence int, includeAllFiles bool,
+	containers *services.ComposeContainers) (serviceDocument, error) {
+	var document serviceDocument = serviceDocument{
+		SchemaVersion: OUTPUT_SCHEMA_VERSION,
+		Sequence:      sequence,
+		Name:          name,
+		Decrypted:     services.GetDecryptedStatusString(services.GetDecryptedFilesStatus(repoRoot, name)),
+		Sync:          services.GetSecretSyncStateString(services.GetServiceSyncStatus(repoRoot, name, true)),
+		ComposeFiles:  []composeFileDocument{},
+		Files:         []serviceFileDocument{},
+	}
+
+	var serviceDirectory string = filepath.Join(repoRoot, config.DockerServicesDir, name)
+	states, err := services.GetAllServiceState(serviceDirectory, containers)
+	if err != nil {
+		return document, err
+	}
+	for _, state := range states {
+		var fileDocument composeFileDocument = composeFileDocument{File: state.File, Variant: state.Label,
+			DockerStatus: services.GetServiceStatusString(state.ServiceState), Containers: []containerDocument{}}
+		fileDocument.Healthy, fileDocument.HealthChecked = state.HealthCount()
+		for _, container := range state.Containers {
+			fileDocument.Containers = append(fileDocument.Containers, containerDocument{Name: container.Name,
+				Service: container.Service, State: container.State, Health: container.Health, ExitCode: container.ExitCode})
+		}
+		document.ComposeFiles = append(document.ComposeFiles, fileDocument)
+	}
+
+	files, err := services.ResolveServiceFiles(repoRoot, name, !includeAllFiles)
+	if err != nil {
+		return document, err
+	}
+	for _, file := range files {
+		var fileDocument serviceFileDocument = serviceFileDocument{Filename: file.Filename,
+			IsSecret: file.IsSecrets, HasDecryptedVersion: file.HasDecryptedVersion}
+		if file.HasDecryptedVersion {
+			syncState, _ := services.GetSecretSyncState(repoRoot, name, file)
+			fileDocument.Sync = services.GetSecretSyncStateString(syncState)
+		}
+		document.Files = append(document.Files, fileDocument)
+	}
+
+	return document, nil
+}
+
+// describeContainer returns the docker state of the container with its
+// health and exit code, e.g. "running (unhealthy)" or "exited (1)"
+func describeContainer(container services.ContainerStatus) string {
+	var description string = container.State
+	if container.State == "exited" {
+		description += fmt.Sprintf(" (%d)", container.ExitCode)
+	}
+	if container.Health != "" {
+		description += " (" + container.Health + ")"
+	}
+	return description
+}
+
 func init() {
 	RootCmd.AddCommand(serviceCmd)
 	serviceCmd.Flags().StringP("name", "n", "", "The name of the service")
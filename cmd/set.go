@@ -18,10 +18,12 @@ package cmd
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"unicode/utf8"
 
 	"github.com/AlstonChan/composectl/internal/config"
 	"github.com/AlstonChan/composectl/internal/services"
@@ -32,16 +34,31 @@ import (
 const (
 	// The default path to the SelfHostCompose repository
 	CONFIG_REPO_PATH = "repo-path"
-	// The default age publick key to use for encryption
+	// The default age or SSH public keys to use for encryption, separated by comma
 	CONFIG_AGE_PUBKEY = "age-pubkey"
 	// The default aws s3 bucket to restore the backup from
 	CONFIG_AWS_S3_BUCKET = "s3-bucket"
+	// The glob patterns of the plaintext secrets for 'encrypt --all', separated by comma
+	CONFIG_SECRET_PATTERNS = "secret-patterns"
+	// The default maximum age of a secret in days for 'secrets age'
+	CONFIG_SECRET_MAX_AGE = "secret-max-age"
+	// The address of the HashiCorp Vault server, e.g. http://127.0.0.1:8200
+	CONFIG_VAULT_ADDR = "vault-addr"
+	// Where to read the Vault token from, "env" or "file:<path>"
+	CONFIG_VAULT_TOKEN_SOURCE = "vault-token-source"
+	// The default Vault transit key to encrypt to, e.g. transit/keys/sops
+	CONFIG_VAULT_TRANSIT_KEY = "vault-transit-key"
 )
 
 var allConfigKey = []string{
 	CONFIG_REPO_PATH,
 	CONFIG_AGE_PUBKEY,
 	CONFIG_AWS_S3_BUCKET,
+	CONFIG_SECRET_PATTERNS,
+	CONFIG_SECRET_MAX_AGE,
+	CONFIG_VAULT_ADDR,
+	CONFIG_VAULT_TOKEN_SOURCE,
+	CONFIG_VAULT_TRANSIT_KEY,
 }
 
 // Set the configuration for the composectl application, so
@@ -106,10 +123,20 @@ the path of the .composectl directory`,
 				}
 				fmt.Printf("Repo root set to %s\n", absPath)
 			case strings.HasPrefix(argument, CONFIG_AGE_PUBKEY):
-				if utf8.RuneCountInString(value) != 62 {
-					fmt.Printf("The public key provided is invalid")
+				// Multiple recipients are separated by comma, the same as sops --age
+				var recipients []string = services.SplitRecipients(value)
+				var invalidRecipient error = nil
+				for _, recipient := range recipients {
+					if err := services.ValidateAgeRecipient(recipient); err != nil {
+						invalidRecipient = err
+						break
+					}
+				}
+				if len(recipients) == 0 || invalidRecipient != nil {
+					fmt.Fprintf(os.Stderr, "The public key provided is invalid: %v\n", invalidRecipient)
 					continue
 				}
+				value = strings.Join(recipients, ",")
 
 				viper.Set(key, value)
 				if err := viper.WriteConfig(); err != nil {
@@ -130,6 +157,102 @@ the path of the .composectl directory`,
 					errorString = err.Error()
 				}
 				fmt.Printf("AWS default restoration s3 bucket set to %s\n", value)
+			case strings.HasPrefix(argument, CONFIG_SECRET_PATTERNS):
+				var patterns []string = services.SplitList(value)
+				var invalidPattern error = nil
+				for _, pattern := range patterns {
+					if _, err := path.Match(pattern, ""); err != nil {
+						invalidPattern = fmt.Errorf("%s: %v", pattern, err)
+						break
+					}
+				}
+				if len(patterns) == 0 || invalidPattern != nil {
+					fmt.Fprintf(os.Stderr, "The secret patterns provided are invalid: %v\n", invalidPattern)
+					continue
+				}
+				value = strings.Join(patterns, ",")
+
+				viper.Set(key, value)
+				if err := viper.WriteConfig(); err != nil {
+					// If config file doesn’t exist, create it
+					if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+						viper.SafeWriteConfig()
+					}
+					errorString = err.Error()
+				}
+				fmt.Printf("Secret patterns set to %s\n", value)
+			case strings.HasPrefix(argument, CONFIG_SECRET_MAX_AGE):
+				days, err := strconv.Atoi(value)
+				if err != nil || days <= 0 {
+					fmt.Fprintf(os.Stderr, "The secret max age must be a positive number of days: %s\n", value)
+					continue
+				}
+
+				viper.Set(key, days)
+				if err := viper.WriteConfig(); err != nil {
+					// If config file doesn’t exist, create it
+					if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+						viper.SafeWriteConfig()
+					}
+					errorString = err.Error()
+				}
+				fmt.Printf("Secret max age set to %d days\n", days)
+			case strings.HasPrefix(argument, CONFIG_VAULT_ADDR):
+				address, err := url.Parse(value)
+				if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+					fmt.Fprintf(os.Stderr, "The Vault address must be an http or https URL: %s\n", value)
+					continue
+				}
+				value = strings.TrimSuffix(value, "/")
+
+				viper.Set(key, value)
+				if err := viper.WriteConfig(); err != nil {
+					// If config file doesn’t exist, create it
+					if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+						viper.SafeWriteConfig()
+					}
+					errorString = err.Error()
+				}
+				fmt.Printf("Vault address set to %s\n", value)
+			case strings.HasPrefix(argument, CONFIG_VAULT_TOKEN_SOURCE):
+				if tokenPath, found := strings.CutPrefix(value, services.VaultTokenSourceFilePrefix); found && tokenPath != "" {
+					// Resolve to absolute path
+					absPath, err := filepath.Abs(tokenPath)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, err.Error())
+						continue
+					}
+					value = services.VaultTokenSourceFilePrefix + absPath
+				} else if value != services.VaultTokenSourceEnv {
+					fmt.Fprintf(os.Stderr, "The Vault token source must be %q or %q: %s\n",
+						services.VaultTokenSourceEnv, services.VaultTokenSourceFilePrefix+"<path>", value)
+					continue
+				}
+
+				viper.Set(key, value)
+				if err := viper.WriteConfig(); err != nil {
+					// If config file doesn’t exist, create it
+					if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+						viper.SafeWriteConfig()
+					}
+					errorString = err.Error()
+				}
+				fmt.Printf("Vault token source set to %s\n", value)
+			case strings.HasPrefix(argument, CONFIG_VAULT_TRANSIT_KEY):
+				if _, err := services.ResolveVaultTransitUri(viper.GetString(CONFIG_VAULT_ADDR), value); err != nil {
+					fmt.Fprintf(os.Stderr, "The Vault transit key provided is invalid: %v\n", err)
+					continue
+				}
+
+				viper.Set(key, value)
+				if err := viper.WriteConfig(); err != nil {
+					// If config file doesn’t exist, create it
+					if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+						viper.SafeWriteConfig()
+					}
+					errorString = err.Error()
+				}
+				fmt.Printf("Vault transit key set to %s\n", value)
 			default:
 				errorString = "Configuration not recognized: " + argument
 			}
@@ -148,7 +271,14 @@ $ composectl COMMAND age-pubkey`, "repo-path", CONFIG_REPO_PATH), "age-pubkey",
 	}
 
 	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(`$ composectl COMMAND repo-path=./
-$ composectl COMMAND age-pubkey=age1...`, "repo-path", CONFIG_REPO_PATH), "age-pubkey", CONFIG_AGE_PUBKEY), "COMMAND", command)
+$ composectl COMMAND age-pubkey=age1...
+$ composectl COMMAND age-pubkey=age1...,age1...
+$ composectl COMMAND "age-pubkey=age1...,ssh-ed25519 AAAA..."
+$ composectl COMMAND secret-patterns=.env,*.ini,*.pem,config.yaml
+$ composectl COMMAND secret-max-age=180
+$ composectl COMMAND vault-addr=http://127.0.0.1:8200
+$ composectl COMMAND vault-token-source=file:/run/secrets/vault-token
+$ composectl COMMAND vault-transit-key=transit/keys/sops`, "repo-path", CONFIG_REPO_PATH), "age-pubkey", CONFIG_AGE_PUBKEY), "COMMAND", command)
 }
 
 func init() {
@@ -29,7 +29,7 @@ var startsCmd = &cobra.Command{
 	Use:   "starts",
 	Short: "Starts a interactive session for starting service",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := deps.CheckSops(); err != nil {
+		if err := checkSops(); err != nil {
 			fmt.Fprintln(os.Stderr, "Error:", err)
 			os.Exit(1)
 		}
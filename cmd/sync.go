@@ -0,0 +1,213 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command brings the decrypted secrets and the encrypted
+// secrets of a service back in sync. A stale decrypted secret
+// (the encrypted file is newer) is decrypted again, and a
+// modified decrypted secret is encrypted again. A secret changed
+// on both sides is left alone unless forced.
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync the decrypted secrets with the encrypted secrets of a service",
+	Long: `Sync the decrypted secrets with the encrypted secrets of a service.
+
+	A "Stale" secret, where the encrypted file is newer than the
+	decrypted file, will be decrypted again and overwrite the
+	decrypted file.
+
+	A "Modified" secret, where the decrypted file was edited but
+	has not been re-encrypted, will be encrypted again and
+	overwrite the encrypted file.
+
+	A "Conflict" secret, where both the decrypted file and the
+	encrypted file changed since the secret was last decrypted or
+	encrypted, is skipped, as either direction loses changes. Merge
+	the changes by hand, or use --force to overwrite the decrypted
+	file, or --force with --prefer encrypt to overwrite the
+	encrypted file.
+
+	When the state is "Unknown" (usually because the private key
+	is not available), use --prefer to choose the direction.`,
+	Example: `  Sync the secrets of a docker service:
+
+  # all secrets by service name (as per 'composectl list')
+  composectl sync -n gitea
+
+  # a particular secret by index (as per 'composectl service')
+  composectl sync -s 12 -i 1
+
+  # always take the encrypted version when the state is unknown
+  composectl sync -n gitea --prefer decrypt
+
+  # discard the local edits of the secrets changed on both sides
+  composectl sync -n gitea --force
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		sequence, _ := cmd.Flags().GetInt("sequence")
+
+		index, _ := cmd.Flags().GetInt("index")
+		publicKey, _ := cmd.Flags().GetString("pubkey")
+		prefer, _ := cmd.Flags().GetString("prefer")
+		force, _ := cmd.Flags().GetBool("force")
+
+		if name == "" && sequence <= 0 {
+			fmt.Fprintln(os.Stderr, "Either the service name or sequence must be specified correctly!")
+			return
+		}
+
+		if prefer != "" && prefer != "encrypt" && prefer != "decrypt" {
+			fmt.Fprintln(os.Stderr, "The --prefer flag only accepts \"encrypt\" or \"decrypt\"")
+			return
+		}
+
+		if err := checkSops(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		if serviceLists == nil && err == nil {
+			return
+		}
+
+		files, err := services.ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error resolving service's details: %v\n", err)
+			return
+		}
+
+		if index > len(files) {
+			fmt.Fprintf(os.Stderr, "the file given index %d does not exists\n", index)
+			return
+		}
+
+		for fileIndex, file := range files {
+			if index > 0 && fileIndex+1 != index {
+				continue
+			}
+
+			state, err := services.GetSecretSyncState(repoRoot, name, file)
+			if state == services.SyncUnknown && prefer != "" {
+				if prefer == "encrypt" {
+					state = services.Modified
+				} else {
+					state = services.Stale
+				}
+			}
+			if state == services.Conflict && force {
+				if prefer == "encrypt" {
+					state = services.Modified
+				} else {
+					state = services.Stale
+				}
+			}
+
+			switch state {
+			case services.InSync:
+				fmt.Printf("%s is in sync\n", file.Filename)
+			case services.NotDecrypted:
+				fmt.Printf("%s is not decrypted, skipping\n", file.Filename)
+			case services.Conflict:
+				fmt.Fprintf(os.Stderr, "%s was changed on both sides since the last sync, merge the changes by hand or use --force to overwrite a side\n",
+					file.Filename)
+			case services.Stale:
+				if err := services.DecryptFile(repoRoot, name, fileIndex+1, file, true); err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to decrypt %s: %v\n", file.Filename, err)
+				}
+			case services.Modified:
+				var encryptedFile string = filepath.Join(repoRoot, config.DockerServicesDir, name, file.Filename)
+				var decryptedFile string = services.DecryptedFilePath(repoRoot, name, file)
+
+				metadata, metadataErr := services.ReadSopsMetadata(encryptedFile)
+
+				// Keep the Vault transit keys the secret was encrypted to
+				var vaultUris []string
+				if metadataErr == nil {
+					vaultUris = metadata.HcVaultTransitUris
+				}
+				if len(vaultUris) == 0 {
+					vaultUris, err = resolveVaultTransitUris("")
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Unable to use the Vault transit key: %v\n", err)
+						return
+					}
+				}
+
+				options, err := resolveEncryptOptions(repoRoot, name, decryptedFile, publicKey, vaultUris)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "An error occurred while resolving the recipients: %v\n", err)
+					return
+				}
+				options.Overwrite = true
+
+				// Keep the partial encryption the secret was encrypted with
+				if metadataErr == nil {
+					options.EncryptedRegex = metadata.EncryptedRegex
+					options.UnencryptedSuffix = metadata.UnencryptedSuffix
+				}
+
+				if err := services.EncryptFileTo(decryptedFile, encryptedFile, options); err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to encrypt %s: %v\n", file.Filename, err)
+				}
+			default:
+				fmt.Fprintf(os.Stderr, "Unable to determine the sync state of %s, use --prefer to choose a direction: %v\n",
+					file.Filename, err)
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().StringP("name", "n", "", "The name of the service")
+	syncCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service")
+	syncCmd.Flags().IntP("index", "i", 0, "Specify the index of the secret to sync (default to all secrets)")
+	syncCmd.Flags().StringP("pubkey", "p", "", "The comma separated age public keys to encrypt modified secrets")
+	syncCmd.Flags().String("prefer", "", "The direction to sync when the state is unknown or forced (encrypt|decrypt)")
+	syncCmd.Flags().Bool("force", false, "Sync the secrets changed on both sides, overwriting the decrypted file unless --prefer encrypt")
+}
@@ -0,0 +1,184 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command onboards a team member: it records the member
+// in the team manifest and re-encrypts the secrets of the
+// services they can access to their public key
+var teamAddCmd = &cobra.Command{
+	Use:   "add <name> <pubkey>",
+	Short: "Add a team member and re-encrypt the secrets of their services",
+	Long: `Add a team member, or update the services of an existing
+	member, in the team manifest.
+
+	The secrets of the given services that are not encrypted to the
+	public key of the member yet are re-encrypted with a rotated
+	data key. When the services of an existing member are reduced,
+	their public key is removed from the secrets of the services
+	they can no longer access. The other secrets are left untouched.
+
+	The services are service names or globs over the service names,
+	e.g. "*" for every service. A summary suitable for the pull
+	request description is printed at the end.`,
+	Example: `  Add a team member:
+
+  # with access to some services
+  composectl team add alice age1... --services gitea,monitoring-*
+
+  # with an SSH public key and access to every service
+  composectl team add bob "ssh-ed25519 AAAA..." --services '*'
+
+  # only show the secrets that would be re-encrypted
+  composectl team add alice age1... --services gitea --dry-run
+`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		servicesFlag, _ := cmd.Flags().GetString("services")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		var memberName string = args[0]
+		var publicKey string = services.NormalizeAgeRecipient(args[1])
+		if err := services.ValidateAgeRecipient(publicKey); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		var patterns []string = services.SplitList(servicesFlag)
+		if len(patterns) == 0 {
+			fmt.Fprintln(os.Stderr, "At least one service must be specified with --services!")
+			return
+		}
+
+		if err := checkSops(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		team, err := services.LoadTeamManifest(repoRoot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		var existing *services.TeamMember = team.Member(memberName)
+		if existing != nil && existing.PublicKey != publicKey {
+			fmt.Fprintf(os.Stderr, "%s is already in the team with another public key, remove them first\n", memberName)
+			return
+		}
+		for _, member := range team.Members {
+			if member.Name != memberName && member.PublicKey == publicKey {
+				fmt.Fprintf(os.Stderr, "The public key is already used by %s\n", member.Name)
+				return
+			}
+		}
+
+		allServices, err := services.ListAllService(repoRoot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+			return
+		}
+
+		addServices, err := services.MatchServices(allServices, patterns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		var removeServices []string
+		if existing != nil {
+			for _, name := range allServices {
+				if existing.CanAccess(name) && !slices.Contains(addServices, name) {
+					removeServices = append(removeServices, name)
+				}
+			}
+		}
+
+		plans, err := services.PlanTeamRekey(repoRoot, publicKey, addServices, removeServices)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to plan the rekey: %v\n", err)
+			return
+		}
+
+		printTeamRekeyPlans(plans)
+
+		// The policy may name the member, so it is checked against the updated team
+		var member services.TeamMember = services.TeamMember{Name: memberName, PublicKey: publicKey, Services: patterns}
+		team.SetMember(member)
+		if err := services.CheckRekeyPolicy(repoRoot, plans, team); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		if dryRun {
+			return
+		}
+
+		if err := checkPlansIdentity(repoRoot, plans); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		var failed []string = rekeyTeamFiles(repoRoot, plans)
+
+		if err := team.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to save the team manifest: %v\n", err)
+			os.Exit(1)
+		}
+
+		var title string = "Add " + memberName + " to the team"
+		if existing != nil {
+			title = "Update the services of " + memberName
+		}
+		fmt.Print("\n" + services.TeamChangeSummary(title, member, plans, failed))
+		warnConfiguredKey(repoRoot, publicKey, removeServices)
+
+		if len(failed) > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d secrets failed to rekey, run 'composectl rekey' to retry\n", len(failed))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	teamCmd.AddCommand(teamAddCmd)
+	teamAddCmd.Flags().String("services", "", "The comma separated services or globs the member can access")
+	teamAddCmd.Flags().Bool("dry-run", false, "Only show the secrets that would be re-encrypted")
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command offboards a team member: it removes the member
+// from the team manifest and re-encrypts the secrets that are
+// encrypted to their public key without it
+var teamRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a team member and re-encrypt the secrets without their key",
+	Long: `Remove a team member from the team manifest.
+
+	Every secret that is encrypted to the public key of the member
+	is re-encrypted without it, with a rotated data key. The other
+	secrets are left untouched.
+
+	The member may have kept a copy of the secrets decrypted before,
+	so the credentials they had access to should be rotated as well.
+	A summary suitable for the pull request description is printed
+	at the end.`,
+	Example: `  Remove a team member:
+
+  # and re-encrypt the secrets without their key
+  composectl team remove alice
+
+  # only show the secrets that would be re-encrypted
+  composectl team remove alice --dry-run
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		if err := checkSops(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		if repoPath == "" {
+			services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+			if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+				repoPath = val
+			}
+		}
+
+		repoRoot, err := services.ResolveRepoRoot(repoPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+			return
+		}
+
+		team, err := services.LoadTeamManifest(repoRoot)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+
+		existing := team.Member(args[0])
+		if existing == nil {
+			fmt.Fprintf(os.Stderr, "%s is not a member of the team\n", args[0])
+			return
+		}
+		var member services.TeamMember = *existing
+
+		allServices, err := services.ListAllService(repoRoot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing services: %v\n", err)
+			return
+		}
+
+		// The key is removed from every secret, including the secrets
+		// that were encrypted to it outside of the member's services
+		plans, err := services.PlanTeamRekey(repoRoot, member.PublicKey, nil, allServices)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to plan the rekey: %v\n", err)
+			return
+		}
+
+		printTeamRekeyPlans(plans)
+
+		team.RemoveMember(member.Name)
+		if err := services.CheckRekeyPolicy(repoRoot, plans, team); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		if dryRun {
+			return
+		}
+
+		if err := checkPlansIdentity(repoRoot, plans); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+
+		var failed []string = rekeyTeamFiles(repoRoot, plans)
+
+		if err := team.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to save the team manifest: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Print("\n" + services.TeamChangeSummary("Remove "+member.Name+" from the team", member, plans, failed))
+		fmt.Println("\nThe credentials in these secrets should be rotated, as they may have been decrypted before.")
+		warnConfiguredKey(repoRoot, member.PublicKey, allServices)
+
+		if len(failed) > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d secrets failed to rekey, run 'composectl rekey' to retry\n", len(failed))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	teamCmd.AddCommand(teamRemoveCmd)
+	teamRemoveCmd.Flags().Bool("dry-run", false, "Only show the secrets that would be re-encrypted")
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The team command groups the commands that manage the members
+// of the team manifest and the secrets they can decrypt
+var teamCmd = &cobra.Command{
+	Use:   "team",
+	Short: "Manage the team members that can decrypt the secrets",
+	Long: strings.ReplaceAll(`Manage the team members that can decrypt the secrets.
+
+	The members, their public keys and the services they can access
+	are kept in the TEAM_FILE file at the repository root, which is
+	meant to be committed. The public keys of the members are added
+	to the recipients of the services they can access by
+	'composectl encrypt', 'composectl rekey' and 'composectl sync'.`,
+		"TEAM_FILE", config.TeamManifestFile),
+}
+
+// printTeamRekeyPlans prints the encrypted files that a team change re-encrypts
+func printTeamRekeyPlans(plans []services.RekeyPlan) {
+	if len(plans) == 0 {
+		fmt.Println("No secrets to re-encrypt")
+		return
+	}
+
+	fmt.Printf("%d secrets will be re-encrypted with a rotated data key:\n", len(plans))
+	for _, plan := range plans {
+		fmt.Printf("  %s\n", filepath.Join(plan.Service, plan.File.Filename))
+		for _, recipient := range plan.AddRecipients {
+			fmt.Printf("      + %s\n", recipient)
+		}
+		for _, recipient := range plan.RemoveRecipients {
+			fmt.Printf("      - %s\n", recipient)
+		}
+	}
+	fmt.Print("\n")
+}
+
+// rekeyTeamFiles re-encrypts the planned files and returns the files that
+// failed, as slash separated paths relative to the repository root
+func rekeyTeamFiles(repoRoot string, plans []services.RekeyPlan) []string {
+	var failed []string
+	for _, plan := range plans {
+		if err := services.RekeyFile(repoRoot, plan); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			failed = append(failed, path.Join(config.DockerServicesDir, plan.Service, plan.File.Filename))
+			continue
+		}
+		fmt.Printf("Rekeyed %s\n", filepath.Join(plan.Service, plan.File.Filename))
+	}
+	return failed
+}
+
+// warnConfiguredKey warns when a public key removed from the secrets of the
+// services is still configured as their recipient, in a matching .sops.yaml
+// creation rule or in the age-pubkey config, as the next encrypt or rekey
+// would add it back
+func warnConfiguredKey(repoRoot string, publicKey string, serviceNames []string) {
+	sopsConfig, err := services.LoadSopsConfig(repoRoot)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+	}
+
+	if sopsConfig != nil {
+		var warned []*services.SopsCreationRule
+		for _, name := range serviceNames {
+			files, err := services.ResolveServiceFiles(repoRoot, name, true)
+			if err != nil {
+				continue
+			}
+
+			for _, file := range files {
+				rule, err := sopsConfig.MatchCreationRule(services.DecryptedFilePath(repoRoot, name, file))
+				if err != nil || rule == nil || slices.Contains(warned, rule) || !slices.Contains(rule.AgeRecipients(), publicKey) {
+					continue
+				}
+				warned = append(warned, rule)
+				fmt.Fprintf(os.Stderr, "Warning: the public key is still a recipient of the creation rule %q in %s, remove it or the next encrypt adds it back\n",
+					rule.PathRegex, sopsConfig.Path)
+			}
+		}
+	}
+
+	services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+	if slices.Contains(services.SplitRecipients(viper.GetString(CONFIG_AGE_PUBKEY)), publicKey) {
+		fmt.Fprintf(os.Stderr, "Warning: the public key is still in the %s config, update it with 'composectl set' or the next encrypt adds it back\n",
+			CONFIG_AGE_PUBKEY)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(teamCmd)
+}
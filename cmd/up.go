@@ -0,0 +1,179 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"github.com/AlstonChan/composectl/internal/deps"
+	"github.com/AlstonChan/composectl/internal/services"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// This command starts a service with docker compose. With
+// --in-memory, the secrets are decrypted to a private tmpfs
+// instead of the repository checkout, and removed once docker
+// compose exits
+var upCmd = &cobra.Command{
+	Use:   "up [-- compose up flags]",
+	Short: "Start a service with docker compose",
+	Long: `Start a service with docker compose.
+
+	With --in-memory, the secrets of the service are decrypted
+	to a private directory on a tmpfs instead of the repository
+	checkout. The decrypted path of each secret is a symlink to
+	its tmpfs copy, and the service .env is given to compose with
+	--env-file. The secrets and the symlinks are removed as soon as
+	docker compose exits, even when it is interrupted.
+
+	The environment variables are copied into the containers when
+	they are created. A running container keeps reading the secret
+	files mounted into it after they are removed, but they can't be
+	mounted again when the container is restarted or recreated, so
+	use 'composectl up' again after a restart.`,
+	Example: `  Start a docker service:
+
+  # by service name (as per 'composectl list')
+  composectl up -n gitea
+
+  # without writing the decrypted secrets to the disk
+  composectl up -n gitea --in-memory
+
+  # with a compose file variant, e.g. compose.dev.yml
+  composectl up -n gitea --variant dev
+
+  # with extra flags for docker compose up
+  composectl up -n gitea -- --build --force-recreate
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		detach, _ := cmd.Flags().GetBool("detach")
+
+		var composeArgs []string = []string{"up"}
+		if detach {
+			composeArgs = append(composeArgs, "--detach")
+		}
+		os.Exit(runServiceCompose(cmd, append(composeArgs, args...)))
+	},
+}
+
+// runServiceCompose runs docker compose with the given arguments for the
+// service selected by the name or sequence flag and returns the exit code.
+// With the in-memory flag, the secrets are decrypted to a tmpfs for the
+// duration of the command.
+func runServiceCompose(cmd *cobra.Command, composeArgs []string) int {
+	name, _ := cmd.Flags().GetString("name")
+	sequence, _ := cmd.Flags().GetInt("sequence")
+
+	variant, _ := cmd.Flags().GetString("variant")
+	inMemory, _ := cmd.Flags().GetBool("in-memory")
+
+	if name == "" && sequence <= 0 {
+		fmt.Fprintln(os.Stderr, "Either the service name or sequence must be specified correctly!")
+		return 1
+	}
+
+	if err := deps.CheckDockerDeps(config.DockerBuildxMajorVersion, config.DockerComposeMajorVersion); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	if repoPath == "" {
+		services.CreateLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+		if val := viper.GetString(CONFIG_REPO_PATH); val != "" {
+			repoPath = val
+		}
+	}
+
+	repoRoot, err := services.ResolveRepoRoot(repoPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving repo root: %v\n", err)
+		return 1
+	}
+
+	serviceLists, err := services.ValidateService(repoRoot, &sequence, &name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	if serviceLists == nil && err == nil {
+		return 1
+	}
+
+	composeFile, err := services.ResolveComposeFile(repoRoot, name, variant)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	var envFile string = ""
+	if inMemory {
+		if err := checkSops(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+
+		// Catch the interrupt while the secrets are prepared, so that the
+		// decrypted secrets and the symlinks are removed before exiting
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+
+		secrets, err := services.PrepareInMemorySecrets(repoRoot, name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		defer func() {
+			if err := secrets.Wipe(); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+		}()
+
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "Interrupted, removing the in-memory secrets")
+			return 130
+		default:
+		}
+
+		for _, existing := range secrets.Existing {
+			fmt.Fprintf(os.Stderr, "Warning: using the decrypted secret %s on disk, remove it with 'composectl clean'\n", existing)
+		}
+		envFile = secrets.EnvFile
+	}
+
+	exitCode, err := services.RunCompose(repoRoot, name, composeFile, envFile, composeArgs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+	return exitCode
+}
+
+func init() {
+	RootCmd.AddCommand(upCmd)
+	upCmd.Flags().StringP("name", "n", "", "The name of the service")
+	upCmd.Flags().IntP("sequence", "s", 0, "The sequence of the service")
+	upCmd.Flags().String("variant", "", "The compose file variant, e.g. dev for compose.dev.yml (default to the base compose file)")
+	upCmd.Flags().Bool("in-memory", false, "Decrypt the secrets to a tmpfs for the duration of the command instead of the checkout")
+	upCmd.Flags().BoolP("detach", "d", false, "Run the containers in the background")
+}
@@ -23,6 +23,20 @@ const (
 	ConfigDirEnv      = "COMPOSECTL_LOCAL"
 
 	SopsAgeKeyFileEnv = "SOPS_AGE_KEY_FILE"
+	// The SSH private key used by sops as an age identity
+	SopsAgeSshPrivateKeyFileEnv = "SOPS_AGE_SSH_PRIVATE_KEY_FILE"
+
+	// The secrets policy of the repository, relative to the repo root
+	SecretsPolicyFile = "secrets-policy.yaml"
+	// The team manifest of the repository, relative to the repo root
+	TeamManifestFile = "team.yaml"
+	// The sync baselines of the decrypted secrets, relative to the local cache directory
+	SyncBaselineDir = "sync"
+
+	// The Docker CLI environment that selects the daemon
+	DockerHostEnv    = "DOCKER_HOST"
+	DockerContextEnv = "DOCKER_CONTEXT"
+	DockerConfigEnv  = "DOCKER_CONFIG"
 
 	DockerComposeMajorVersion = 5
 	DockerBuildxMajorVersion  = 0
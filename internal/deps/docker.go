@@ -18,11 +18,17 @@ package deps
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/AlstonChan/composectl/internal/config"
 	"github.com/moby/moby/client"
 )
 
@@ -88,7 +94,21 @@ func GetDockerClient(requiredBuildxMajor, requiredComposeMajor int) (*client.Cli
 		return nil, err
 	}
 
-	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	return NewDockerClient()
+}
+
+// NewDockerClient returns a Docker client connected to the daemon of the
+// environment, or of the current docker context like the Docker CLI,
+// without checking the Docker CLI plugins. The caller is responsible for
+// closing the returned client.
+func NewDockerClient() (*client.Client, error) {
+	contextOpts, err := dockerContextOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []client.Opt = append([]client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}, contextOpts...)
+	dockerClient, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -104,3 +124,106 @@ func GetDockerClient(requiredBuildxMajor, requiredComposeMajor int) (*client.Cli
 
 	return dockerClient, nil
 }
+
+// The metadata of a docker context stored by the Docker CLI, only the
+// endpoint of the docker daemon is read
+type dockerContextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// dockerContextOpts returns the client options that connect to the
+// endpoint of the current docker context. The context is resolved like
+// the Docker CLI does: DOCKER_HOST takes precedence, then DOCKER_CONTEXT,
+// then the currentContext of the Docker CLI config.json. No option is
+// returned for the default context, which is the environment.
+func dockerContextOpts() ([]client.Opt, error) {
+	if os.Getenv(config.DockerHostEnv) != "" {
+		return nil, nil
+	}
+
+	configDir, err := dockerConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var contextName string = os.Getenv(config.DockerContextEnv)
+	if contextName == "" {
+		content, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("unable to read the Docker CLI config: %v", err)
+		}
+		if err == nil {
+			var cliConfig struct {
+				CurrentContext string `json:"currentContext"`
+			}
+			if err := json.Unmarshal(content, &cliConfig); err != nil {
+				return nil, fmt.Errorf("unable to parse the Docker CLI config: %v", err)
+			}
+			contextName = cliConfig.CurrentContext
+		}
+	}
+
+	if contextName == "" || contextName == "default" {
+		return nil, nil
+	}
+
+	// The Docker CLI stores a context in a directory named after the
+	// sha256 digest of its name
+	digest := sha256.Sum256([]byte(contextName))
+	var contextId string = hex.EncodeToString(digest[:])
+
+	content, err := os.ReadFile(filepath.Join(configDir, "contexts", "meta", contextId, "meta.json"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the docker context %q: %v", contextName, err)
+	}
+	var meta dockerContextMeta
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return nil, fmt.Errorf("unable to parse the docker context %q: %v", contextName, err)
+	}
+
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok || endpoint.Host == "" {
+		return nil, fmt.Errorf("the docker context %q has no docker endpoint", contextName)
+	}
+	if strings.HasPrefix(endpoint.Host, "ssh://") {
+		return nil, fmt.Errorf("the ssh endpoint of the docker context %q is only supported by the Docker CLI", contextName)
+	}
+	if endpoint.SkipTLSVerify {
+		return nil, fmt.Errorf("the docker context %q skips the TLS verification, which is only supported by the Docker CLI", contextName)
+	}
+
+	var opts []client.Opt = []client.Opt{client.WithHost(endpoint.Host)}
+
+	// The TLS material of the endpoint, when the context has any
+	var tlsDir string = filepath.Join(configDir, "contexts", "tls", contextId, "docker")
+	if _, err := os.Stat(tlsDir); err == nil {
+		var caFile, certFile, keyFile string = filepath.Join(tlsDir, "ca.pem"), filepath.Join(tlsDir, "cert.pem"),
+			filepath.Join(tlsDir, "key.pem")
+		for _, file := range []*string{&caFile, &certFile, &keyFile} {
+			if _, err := os.Stat(*file); err != nil {
+				*file = ""
+			}
+		}
+		opts = append(opts, client.WithTLSClientConfig(caFile, certFile, keyFile))
+	}
+
+	return opts, nil
+}
+
+// dockerConfigDir returns the directory of the Docker CLI config,
+// DOCKER_CONFIG or ~/.docker
+func dockerConfigDir() (string, error) {
+	if configDir := os.Getenv(config.DockerConfigEnv); configDir != "" {
+		return configDir, nil
+	}
+
+	userDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine $HOME directory to locate the Docker CLI config")
+	}
+	return filepath.Join(userDir, ".docker"), nil
+}
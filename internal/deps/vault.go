@@ -0,0 +1,61 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deps
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CheckVault checks that the Vault server of every transit key URI is
+// initialized and unsealed, e.g. http://127.0.0.1:8200/v1/transit/keys/sops
+//
+// The transit key itself is not read, as a least privilege sops token
+// only has update on transit/encrypt/<key> and transit/decrypt/<key>,
+// so a missing key or a denied token is reported by sops instead.
+func CheckVault(transitUris []string) error {
+	var httpClient *http.Client = &http.Client{Timeout: 5 * time.Second}
+
+	for _, uri := range transitUris {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			return fmt.Errorf("invalid Vault transit key %q: %v", uri, err)
+		}
+
+		// A standby node can serve the request as well
+		var healthUrl string = parsed.Scheme + "://" + parsed.Host + "/v1/sys/health?standbyok=true"
+		response, err := httpClient.Get(healthUrl)
+		if err != nil {
+			return fmt.Errorf("unable to connect to Vault at %s: %v", parsed.Host, err)
+		}
+		response.Body.Close()
+
+		switch response.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotImplemented:
+			return fmt.Errorf("Vault at %s is not initialized", parsed.Host)
+		case http.StatusServiceUnavailable:
+			return fmt.Errorf("Vault at %s is sealed", parsed.Host)
+		default:
+			return fmt.Errorf("Vault at %s is unhealthy, health check returned %s", parsed.Host, response.Status)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,339 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The human readable parts of the bech32 encoded age keys
+const (
+	agePublicKeyHrp = "age"
+	ageSecretKeyHrp = "age-secret-key-"
+)
+
+// The prefix of the age identities created by age plugins, e.g. age-plugin-yubikey
+const agePluginIdentityPrefix = "AGE-PLUGIN-"
+
+// AgeIdentity is a single identity of an age keys.txt file
+type AgeIdentity struct {
+	// The public key of the identity, empty when it can't be derived
+	// from a plugin identity that has no "# public key:" comment
+	PublicKey string
+	// The AGE-SECRET-KEY-1... or AGE-PLUGIN-... line
+	SecretKey string
+	// The time from the "# created:" comment, zero when absent
+	Created time.Time
+	// Whether the identity is handled by an age plugin
+	Plugin bool
+}
+
+// GenerateAgeIdentity creates a new X25519 age identity, the same as age-keygen
+func GenerateAgeIdentity() (AgeIdentity, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return AgeIdentity{}, fmt.Errorf("unable to generate the key: %v", err)
+	}
+
+	secretKey, err := bech32Encode(ageSecretKeyHrp, privateKey.Bytes())
+	if err != nil {
+		return AgeIdentity{}, err
+	}
+	publicKey, err := bech32Encode(agePublicKeyHrp, privateKey.PublicKey().Bytes())
+	if err != nil {
+		return AgeIdentity{}, err
+	}
+
+	return AgeIdentity{
+		PublicKey: publicKey,
+		SecretKey: strings.ToUpper(secretKey),
+		Created:   time.Now().Truncate(time.Second),
+	}, nil
+}
+
+// AgePublicKeyFromSecret derives the age public key from an AGE-SECRET-KEY-1... identity
+func AgePublicKeyFromSecret(secretKey string) (string, error) {
+	hrp, data, err := bech32Decode(secretKey)
+	if err != nil {
+		return "", fmt.Errorf("malformed age secret key: %v", err)
+	}
+	if hrp != ageSecretKeyHrp {
+		return "", fmt.Errorf("malformed age secret key: unexpected prefix %q", strings.ToUpper(hrp))
+	}
+
+	privateKey, err := ecdh.X25519().NewPrivateKey(data)
+	if err != nil {
+		return "", fmt.Errorf("malformed age secret key: %v", err)
+	}
+
+	return bech32Encode(agePublicKeyHrp, privateKey.PublicKey().Bytes())
+}
+
+// ParseAgeIdentities parses the identities of an age keys.txt file. The
+// public key of the X25519 identities is derived from the secret key, so
+// the "# public key:" comments are only used for the plugin identities.
+func ParseAgeIdentities(content []byte) ([]AgeIdentity, error) {
+	var identities []AgeIdentity
+	var publicKeyComment string = ""
+	var created time.Time
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	var lineNumber int = 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "# public key:"):
+			publicKeyComment = strings.TrimSpace(strings.TrimPrefix(line, "# public key:"))
+		case strings.HasPrefix(line, "# created:"):
+			if value, err := time.Parse(time.RFC3339, strings.TrimSpace(strings.TrimPrefix(line, "# created:"))); err == nil {
+				created = value
+			}
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, agePluginIdentityPrefix):
+			identities = append(identities, AgeIdentity{PublicKey: publicKeyComment, SecretKey: line, Created: created, Plugin: true})
+			publicKeyComment, created = "", time.Time{}
+		default:
+			publicKey, err := AgePublicKeyFromSecret(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			identities = append(identities, AgeIdentity{PublicKey: publicKey, SecretKey: line, Created: created})
+			publicKeyComment, created = "", time.Time{}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// ReadAgeIdentities reads the identities of the age keys.txt file at the path
+func ReadAgeIdentities(path string) ([]AgeIdentity, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unable to locate the age file: %w", err)
+		}
+		return nil, fmt.Errorf("error opening age file: %w", err)
+	}
+
+	identities, err := ParseAgeIdentities(content)
+	if err != nil {
+		return nil, fmt.Errorf("error reading age file %s: %v", path, err)
+	}
+	return identities, nil
+}
+
+// AddAgeIdentities appends the identities to the age keys.txt file at the
+// path, in the format written by age-keygen. The file and its directory are
+// created with owner only permissions when they don't exist. The identities
+// already in the file are skipped, and the identities that are added are
+// returned.
+func AddAgeIdentities(path string, identities []AgeIdentity) ([]AgeIdentity, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error opening age file: %v", err)
+	}
+
+	existing, err := ParseAgeIdentities(content)
+	if err != nil {
+		return nil, fmt.Errorf("error reading age file %s: %v", path, err)
+	}
+
+	var known map[string]bool = make(map[string]bool)
+	for _, identity := range existing {
+		known[identity.SecretKey] = true
+	}
+
+	var added []AgeIdentity
+	var buffer bytes.Buffer
+	// Keep the identities on their own lines when the file lacks a trailing newline
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		buffer.WriteString("\n")
+	}
+	for _, identity := range identities {
+		if known[identity.SecretKey] {
+			continue
+		}
+		known[identity.SecretKey] = true
+
+		if !identity.Created.IsZero() {
+			fmt.Fprintf(&buffer, "# created: %s\n", identity.Created.Format(time.RFC3339))
+		}
+		if identity.PublicKey != "" {
+			fmt.Fprintf(&buffer, "# public key: %s\n", identity.PublicKey)
+		}
+		fmt.Fprintf(&buffer, "%s\n", identity.SecretKey)
+		added = append(added, identity)
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("unable to create the directory of %s: %v", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(buffer.Bytes()); err != nil {
+		return nil, fmt.Errorf("unable to write to %s: %v", path, err)
+	}
+
+	return added, nil
+}
+
+// bech32Encode encodes the data with the bech32 encoding of BIP 173. Unlike
+// BIP 173 there is no limit on the length, the same as age.
+func bech32Encode(hrp string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	result.WriteString(hrp)
+	result.WriteByte('1')
+	for _, value := range append(values, bech32Checksum(hrp, values)...) {
+		result.WriteByte(bech32Charset[value])
+	}
+	return result.String(), nil
+}
+
+// bech32Decode decodes a bech32 string, returning the lowercase human
+// readable part and the data
+func bech32Decode(value string) (string, []byte, error) {
+	if strings.ToLower(value) != value && strings.ToUpper(value) != value {
+		return "", nil, fmt.Errorf("mixed case")
+	}
+	value = strings.ToLower(value)
+
+	var separator int = strings.LastIndexByte(value, '1')
+	if separator < 1 || separator+7 > len(value) {
+		return "", nil, fmt.Errorf("invalid separator position")
+	}
+
+	var hrp string = value[:separator]
+	var values []byte
+	for _, char := range value[separator+1:] {
+		index := strings.IndexRune(bech32Charset, char)
+		if index == -1 {
+			return "", nil, fmt.Errorf("invalid character %q", char)
+		}
+		values = append(values, byte(index))
+	}
+
+	if bech32Polymod(append(bech32HrpExpand(hrp), values...)) != 1 {
+		return "", nil, fmt.Errorf("invalid checksum")
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	var generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	var checksum uint32 = 1
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	var expanded []byte
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32Checksum(hrp string, values []byte) []byte {
+	var input []byte = append(bech32HrpExpand(hrp), values...)
+	input = append(input, 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(input) ^ 1
+
+	var checksum []byte = make([]byte, 6)
+	for i := 0; i < 6; i++ {
+		checksum[i] = byte((polymod >> uint(5*(5-i))) & 31)
+	}
+	return checksum
+}
+
+// convertBits regroups the data from groups of fromBits to groups of toBits
+func convertBits(data []byte, fromBits uint, toBits uint, pad bool) ([]byte, error) {
+	var accumulator uint32 = 0
+	var bits uint = 0
+	var maxValue uint32 = (1 << toBits) - 1
+
+	var result []byte
+	for _, value := range data {
+		if uint32(value)>>fromBits != 0 {
+			return nil, fmt.Errorf("invalid data range")
+		}
+		accumulator = accumulator<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte((accumulator>>bits)&maxValue))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			result = append(result, byte((accumulator<<(toBits-bits))&maxValue))
+		}
+	} else if bits >= fromBits || (accumulator<<(toBits-bits))&maxValue != 0 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+
+	return result, nil
+}
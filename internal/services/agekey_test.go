@@ -0,0 +1,210 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The BIP 173 test vectors of the bech32 encoding
+func TestBech32DecodeVectors(t *testing.T) {
+	var valid = []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"11" + strings.Repeat("q", 82) + "c8247j",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	}
+	for _, value := range valid {
+		t.Run(value, func(t *testing.T) {
+			hrp, data, err := bech32Decode(value)
+			if err != nil {
+				t.Fatalf("bech32Decode(%q) error = %v", value, err)
+			}
+			encoded, err := bech32Encode(hrp, data)
+			if err != nil {
+				t.Fatalf("bech32Encode(%q) error = %v", hrp, err)
+			}
+			if encoded != strings.ToLower(value) {
+				t.Errorf("bech32Encode(bech32Decode(%q)) = %q", value, encoded)
+			}
+		})
+	}
+
+	var invalid = []struct {
+		name  string
+		value string
+	}{
+		{"no separator", "pzry9x0s0muk"},
+		{"empty human readable part", "1pzry9x0s0muk"},
+		{"invalid data character", "x1b4n0q5v"},
+		{"checksum too short", "li1dgmt3"},
+		{"empty human readable part and short data", "10a06t8"},
+		{"checksum of the uppercase human readable part", "A1G7SGD8"},
+		{"mixed case", "A12uEL5L"},
+		{"invalid checksum", "a12uel5m"},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := bech32Decode(test.value); err == nil {
+				t.Errorf("bech32Decode(%q) succeeded, want an error", test.value)
+			}
+		})
+	}
+}
+
+func TestBech32RoundTrip(t *testing.T) {
+	var tests = []struct {
+		hrp  string
+		data []byte
+	}{
+		{agePublicKeyHrp, bytes.Repeat([]byte{0x00}, 32)},
+		{agePublicKeyHrp, bytes.Repeat([]byte{0xff}, 32)},
+		{ageSecretKeyHrp, []byte{0x01, 0x02, 0x03}},
+		{"a", nil},
+	}
+
+	for _, test := range tests {
+		encoded, err := bech32Encode(test.hrp, test.data)
+		if err != nil {
+			t.Fatalf("bech32Encode(%q, %x) error = %v", test.hrp, test.data, err)
+		}
+		hrp, data, err := bech32Decode(encoded)
+		if err != nil {
+			t.Fatalf("bech32Decode(%q) error = %v", encoded, err)
+		}
+		if hrp != test.hrp || !bytes.Equal(data, test.data) {
+			t.Errorf("bech32Decode(%q) = %q, %x, want %q, %x", encoded, hrp, data, test.hrp, test.data)
+		}
+		// An age key is decoded from its uppercase form as well
+		if _, _, err := bech32Decode(strings.ToUpper(encoded)); err != nil {
+			t.Errorf("bech32Decode(%q) error = %v", strings.ToUpper(encoded), err)
+		}
+	}
+
+	identity, err := GenerateAgeIdentity()
+	if err != nil {
+		t.Fatalf("GenerateAgeIdentity() error = %v", err)
+	}
+	if err := ValidateAgeRecipient(identity.PublicKey); err != nil {
+		t.Errorf("GenerateAgeIdentity() public key: %v", err)
+	}
+	if !strings.HasPrefix(identity.SecretKey, "AGE-SECRET-KEY-1") {
+		t.Errorf("GenerateAgeIdentity() secret key = %q, want the AGE-SECRET-KEY-1 prefix", identity.SecretKey)
+	}
+}
+
+// The X25519 key pair of RFC 7748 section 6.1
+const (
+	rfc7748PrivateKey = "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"
+	rfc7748PublicKey  = "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a"
+)
+
+// testAgeKeyPair returns the age identity and recipient of the RFC 7748 key pair
+func testAgeKeyPair(t *testing.T) (string, string) {
+	t.Helper()
+
+	privateKey, _ := hex.DecodeString(rfc7748PrivateKey)
+	publicKey, _ := hex.DecodeString(rfc7748PublicKey)
+
+	secretKey, err := bech32Encode(ageSecretKeyHrp, privateKey)
+	if err != nil {
+		t.Fatalf("bech32Encode() error = %v", err)
+	}
+	recipient, err := bech32Encode(agePublicKeyHrp, publicKey)
+	if err != nil {
+		t.Fatalf("bech32Encode() error = %v", err)
+	}
+	return strings.ToUpper(secretKey), recipient
+}
+
+func TestAgePublicKeyFromSecret(t *testing.T) {
+	secretKey, recipient := testAgeKeyPair(t)
+
+	got, err := AgePublicKeyFromSecret(secretKey)
+	if err != nil {
+		t.Fatalf("AgePublicKeyFromSecret() error = %v", err)
+	}
+	if got != recipient {
+		t.Errorf("AgePublicKeyFromSecret() = %q, want %q", got, recipient)
+	}
+
+	if _, err := AgePublicKeyFromSecret(recipient); err == nil {
+		t.Errorf("AgePublicKeyFromSecret() of a public key, want an error")
+	}
+}
+
+func TestParseAgeIdentities(t *testing.T) {
+	secretKey, recipient := testAgeKeyPair(t)
+	var pluginKey string = "AGE-PLUGIN-YUBIKEY-1QQQQQQQQQQQQQQ"
+	var created time.Time = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var tests = []struct {
+		name    string
+		content string
+		want    []AgeIdentity
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"age-keygen format",
+			"# created: 2025-01-02T03:04:05Z\n# public key: " + recipient + "\n" + secretKey + "\n",
+			[]AgeIdentity{{PublicKey: recipient, SecretKey: secretKey, Created: created}}, false},
+		{"public key derived instead of the comment",
+			"# public key: age1wrong\n" + secretKey + "\n",
+			[]AgeIdentity{{PublicKey: recipient, SecretKey: secretKey}}, false},
+		{"plugin identity with the public key comment",
+			"# public key: " + recipient + "\n\n" + pluginKey + "\n",
+			[]AgeIdentity{{PublicKey: recipient, SecretKey: pluginKey, Plugin: true}}, false},
+		{"comments only apply to the next identity",
+			"# created: 2025-01-02T03:04:05Z\n" + pluginKey + "\n" + secretKey + "\n",
+			[]AgeIdentity{
+				{SecretKey: pluginKey, Created: created, Plugin: true},
+				{PublicKey: recipient, SecretKey: secretKey},
+			}, false},
+		{"crlf line endings and indentation", "  " + secretKey + "\r\n",
+			[]AgeIdentity{{PublicKey: recipient, SecretKey: secretKey}}, false},
+		{"malformed identity", "# comment\nAGE-SECRET-KEY-1INVALID\n", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseAgeIdentities([]byte(test.content))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseAgeIdentities() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("ParseAgeIdentities() = %+v, want %+v", got, test.want)
+			}
+			for index := range got {
+				if got[index] != test.want[index] {
+					t.Errorf("ParseAgeIdentities()[%d] = %+v, want %+v", index, got[index], test.want[index])
+				}
+			}
+		})
+	}
+
+	if _, err := ParseAgeIdentities([]byte("# comment\nAGE-SECRET-KEY-1INVALID\n")); err == nil ||
+		!strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("ParseAgeIdentities() error = %v, want the line number", err)
+	}
+}
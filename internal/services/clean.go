@@ -0,0 +1,109 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+)
+
+// CleanResult is the outcome of removing the decrypted counterpart of a secret
+type CleanResult struct {
+	File          ServiceFile
+	DecryptedFile string
+	State         SecretSyncState
+	Removed       bool
+	Err           error
+}
+
+// CleanService removes the decrypted counterpart of every secret of the
+// service. A decrypted file is only removed when it is InSync with the
+// encrypted file, so that edits which were never re-encrypted are not lost.
+// When shred is true, the file content is overwritten before it is removed.
+func CleanService(repoRoot string, name string, shred bool) ([]CleanResult, error) {
+	files, err := ResolveServiceFiles(repoRoot, name, true)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving service's details: %v", err)
+	}
+
+	var results []CleanResult
+	for _, file := range files {
+		if !file.HasDecryptedVersion {
+			continue
+		}
+
+		var result CleanResult = CleanResult{File: file, DecryptedFile: DecryptedFilePath(repoRoot, name, file)}
+
+		result.State, result.Err = GetSecretSyncState(repoRoot, name, file)
+		if result.State == NotDecrypted {
+			continue
+		}
+		if result.State != InSync {
+			if result.Err == nil {
+				result.Err = fmt.Errorf("the decrypted file is %s, re-encrypt or sync it first",
+					GetSecretSyncStateString(result.State))
+			}
+			results = append(results, result)
+			continue
+		}
+
+		if err := RemoveDecryptedFile(result.DecryptedFile, shred); err != nil {
+			result.Err = err
+		} else {
+			result.Removed = true
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// RemoveDecryptedFile removes a decrypted secret. When shred is true, the
+// content is overwritten with random data and synced to disk first. This
+// is best effort, as journaling and copy-on-write filesystems may still
+// keep the original blocks.
+func RemoveDecryptedFile(path string, shred bool) error {
+	if shred {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("unable to open %s to overwrite it: %v", path, err)
+		}
+
+		if _, err := io.CopyN(file, rand.Reader, info.Size()); err != nil {
+			file.Close()
+			return fmt.Errorf("unable to overwrite %s: %v", path, err)
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return fmt.Errorf("unable to overwrite %s: %v", path, err)
+		}
+		file.Close()
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("unable to remove %s: %v", path, err)
+	}
+	removeSyncBaseline(path)
+	return nil
+}
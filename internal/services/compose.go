@@ -0,0 +1,107 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+// ResolveComposeFile returns the compose file of the service for the given
+// variant, relative to the service directory. The empty variant is the
+// base compose.yml or docker-compose.yml.
+func ResolveComposeFile(repoRoot string, name string, variant string) (string, error) {
+	var servicePath string = filepath.Join(repoRoot, config.DockerServicesDir, name)
+
+	composeFiles, err := FindComposeFiles(servicePath)
+	if err != nil {
+		return "", fmt.Errorf("unable to find the compose files of %s: %v", name, err)
+	}
+
+	for _, file := range composeFiles {
+		label, err := ExtractComposeVariant(file)
+		if err == nil && label == variant {
+			return file, nil
+		}
+	}
+
+	if variant == "" {
+		return "", fmt.Errorf("the service %s does not have a base compose file", name)
+	}
+	return "", fmt.Errorf("the service %s does not have a compose file for the variant %s", name, variant)
+}
+
+// RunCompose runs 'docker compose' with the given arguments in the service
+// directory, attached to the terminal, and returns its exit code. When
+// envFile is not empty, it is given to compose with --env-file.
+//
+// The interrupt signal reaches compose directly from the terminal, so it
+// is ignored here to give the caller a chance to clean up once compose
+// exits. A termination signal is forwarded to compose.
+func RunCompose(repoRoot string, name string, composeFile string, envFile string, args []string) (int, error) {
+	var composeArgs []string = []string{"compose", "-f", composeFile}
+	if envFile != "" {
+		composeArgs = append(composeArgs, "--env-file", envFile)
+	}
+	composeArgs = append(composeArgs, args...)
+
+	cmd := exec.Command("docker", composeArgs...)
+	cmd.Dir = filepath.Join(repoRoot, config.DockerServicesDir, name)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 1, fmt.Errorf("unable to run docker compose: %v", err)
+	}
+
+	var done chan struct{} = make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGTERM {
+					cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, fmt.Errorf("unable to run docker compose: %v", err)
+	}
+	return 0, nil
+}
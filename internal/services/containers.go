@@ -0,0 +1,157 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/filters"
+	"github.com/moby/moby/client"
+)
+
+// The labels docker compose sets on the containers it creates
+const (
+	composeProjectLabel     = "com.docker.compose.project"
+	composeWorkingDirLabel  = "com.docker.compose.project.working_dir"
+	composeConfigFilesLabel = "com.docker.compose.project.config_files"
+	composeServiceLabel     = "com.docker.compose.service"
+)
+
+// The health and the exit code in the status of the container list
+var (
+	containerHealthRegex   = regexp.MustCompile(`\((?:health: )?(healthy|unhealthy|starting)\)$`)
+	containerExitCodeRegex = regexp.MustCompile(`^Exited \((-?\d+)\)`)
+)
+
+// ComposeContainers is a snapshot of the containers created by docker
+// compose, indexed by the compose files and the working directory of
+// their project, so that the state of every service can be resolved
+// from a single query of the Docker Engine API
+type ComposeContainers struct {
+	byConfigFile map[string][]container.Summary
+	byWorkingDir map[string][]container.Summary
+}
+
+// LoadComposeContainers lists the containers of every compose project,
+// at any status, with a single ContainerList call
+func LoadComposeContainers(docker *client.Client, ctx context.Context) (*ComposeContainers, error) {
+	summaries, err := docker.ContainerList(ctx, client.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", composeProjectLabel)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the containers: %v", err)
+	}
+
+	var containers *ComposeContainers = &ComposeContainers{
+		byConfigFile: make(map[string][]container.Summary),
+		byWorkingDir: make(map[string][]container.Summary),
+	}
+	for _, summary := range summaries {
+		if workingDir := summary.Labels[composeWorkingDirLabel]; workingDir != "" {
+			var key string = canonicalPath(workingDir)
+			containers.byWorkingDir[key] = append(containers.byWorkingDir[key], summary)
+		}
+
+		// The compose files are absolute paths joined by a comma, a
+		// container belongs to each of the files of its project
+		for _, configFile := range strings.Split(summary.Labels[composeConfigFilesLabel], ",") {
+			if configFile = strings.TrimSpace(configFile); configFile == "" {
+				continue
+			}
+			var key string = canonicalPath(configFile)
+			containers.byConfigFile[key] = append(containers.byConfigFile[key], summary)
+		}
+	}
+
+	return containers, nil
+}
+
+// HasProjectsIn reports whether the snapshot has a container of a compose
+// project in the directory, e.g. the services directory of the repository.
+// A snapshot without any is likely of another daemon than the one the
+// services run on, and shouldn't be trusted.
+func (c *ComposeContainers) HasProjectsIn(directory string) bool {
+	var prefix string = canonicalPath(directory) + string(filepath.Separator)
+	for _, paths := range []map[string][]container.Summary{c.byConfigFile, c.byWorkingDir} {
+		for path := range paths {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ServiceState returns the state of the containers created from the
+// compose file, relative to the project directory. The containers
+// without the config_files label are matched by the working directory.
+func (c *ComposeContainers) ServiceState(projectDir string, composeFile string) (ServiceState, []ContainerStatus) {
+	var summaries []container.Summary = c.byConfigFile[canonicalPath(filepath.Join(projectDir, composeFile))]
+	for _, summary := range c.byWorkingDir[canonicalPath(projectDir)] {
+		if summary.Labels[composeConfigFilesLabel] == "" {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	var containers []ContainerStatus = make([]ContainerStatus, 0, len(summaries))
+	for _, summary := range summaries {
+		containers = append(containers, containerStatusOf(summary))
+	}
+	return composeServiceState(containers), containers
+}
+
+// containerStatusOf returns the status of a container of the container list.
+// The health and the exit code are parsed from the human readable status,
+// e.g. "Up 2 hours (unhealthy)" or "Exited (1) 3 minutes ago", when the
+// API version doesn't report the health.
+func containerStatusOf(summary container.Summary) ContainerStatus {
+	var status ContainerStatus = ContainerStatus{
+		Service: summary.Labels[composeServiceLabel],
+		State:   summary.State,
+	}
+	if len(summary.Names) > 0 {
+		status.Name = strings.TrimPrefix(summary.Names[0], "/")
+	}
+
+	if summary.Health != nil && summary.Health.Status != container.NoHealthcheck {
+		status.Health = summary.Health.Status
+	} else if match := containerHealthRegex.FindStringSubmatch(summary.Status); match != nil {
+		status.Health = match[1]
+	}
+
+	if match := containerExitCodeRegex.FindStringSubmatch(summary.Status); match != nil {
+		status.ExitCode, _ = strconv.Atoi(match[1])
+	}
+
+	return status
+}
+
+// canonicalPath resolves the symlinks of the path when it exists, so that
+// the paths of the labels match the paths of the repository
+func canonicalPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/moby/moby/api/types/container"
+)
+
+func TestContainerStatusOf(t *testing.T) {
+	var tests = []struct {
+		name    string
+		summary container.Summary
+		want    ContainerStatus
+	}{
+		{"running without a health check",
+			container.Summary{Names: []string{"/gitea-app-1"}, State: "running", Status: "Up 2 hours",
+				Labels: map[string]string{composeServiceLabel: "app"}},
+			ContainerStatus{Name: "gitea-app-1", Service: "app", State: "running"}},
+		{"health from the status",
+			container.Summary{State: "running", Status: "Up 2 hours (unhealthy)"},
+			ContainerStatus{State: "running", Health: "unhealthy"}},
+		{"starting health from the status",
+			container.Summary{State: "running", Status: "Up 5 seconds (health: starting)"},
+			ContainerStatus{State: "running", Health: "starting"}},
+		{"health from the API",
+			container.Summary{State: "running", Status: "Up 2 hours (unhealthy)",
+				Health: &container.HealthSummary{Status: container.Healthy}},
+			ContainerStatus{State: "running", Health: "healthy"}},
+		{"no health check from the API",
+			container.Summary{State: "running", Status: "Up 2 hours",
+				Health: &container.HealthSummary{Status: container.NoHealthcheck}},
+			ContainerStatus{State: "running"}},
+		{"exit code",
+			container.Summary{State: "exited", Status: "Exited (137) 3 minutes ago"},
+			ContainerStatus{State: "exited", ExitCode: 137}},
+		{"restarting is not an exit code",
+			container.Summary{State: "restarting", Status: "Restarting (1) 5 seconds ago"},
+			ContainerStatus{State: "restarting"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := containerStatusOf(test.summary); got != test.want {
+				t.Errorf("containerStatusOf() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHasProjectsIn(t *testing.T) {
+	var servicesDir string = t.TempDir()
+	var containers *ComposeContainers = testComposeContainers(
+		composeContainer(filepath.Join(servicesDir, "gitea"), "compose.yml", "running", "Up 2 hours"))
+
+	if !containers.HasProjectsIn(servicesDir) {
+		t.Errorf("HasProjectsIn(%q) = false, want true", servicesDir)
+	}
+	// A sibling directory sharing the prefix isn't a parent
+	if containers.HasProjectsIn(servicesDir + "-other") {
+		t.Errorf("HasProjectsIn(%q) = true, want false", servicesDir+"-other")
+	}
+	if testComposeContainers().HasProjectsIn(servicesDir) {
+		t.Errorf("HasProjectsIn() of an empty snapshot = true, want false")
+	}
+}
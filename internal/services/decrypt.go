@@ -17,6 +17,8 @@ limitations under the License.
 package services
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -26,6 +28,10 @@ import (
 	"github.com/AlstonChan/composectl/internal/config"
 )
 
+// ErrDecryptedFileExists is returned when the decrypted counterpart of a
+// secret already exists and overwriting it is not allowed
+var ErrDecryptedFileExists = errors.New("an decrypted file already exists, specify -o to overwrite it")
+
 func DecryptAllFile(repoRoot string, name string, overwrite bool) error {
 	files, err := ResolveServiceFiles(repoRoot, name, true)
 	if err != nil {
@@ -48,71 +54,134 @@ func DecryptAllFile(repoRoot string, name string, overwrite bool) error {
 }
 
 func DecryptFile(repoRoot string, name string, index int, file ServiceFile, overwrite bool) error {
+	filename, err := DecryptServiceFile(repoRoot, name, index, file, overwrite)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("File %s decrypted successfully\n", filename)
+	return nil
+}
+
+// DecryptServiceFile decrypts a secret of the service to its decrypted
+// counterpart and returns the decrypted filename. Unlike DecryptFile,
+// it doesn't print anything on success so it can be used concurrently.
+func DecryptServiceFile(repoRoot string, name string, index int, file ServiceFile, overwrite bool) (string, error) {
 	var servicePath string = filepath.Join(repoRoot, config.DockerServicesDir, name)
 	var targetFilePath string = filepath.Join(servicePath, file.Filename)
 
 	_, err := os.Stat(targetFilePath)
 	if err != nil {
-		return fmt.Errorf("the file given index %d cannot be found at %s", index, targetFilePath)
+		return "", fmt.Errorf("the file given index %d cannot be found at %s", index, targetFilePath)
 	}
 
-	fileType, filename := parseEncFilename(targetFilePath, file.Filename)
+	_, filename := parseEncFilename(targetFilePath, file.Filename)
 
 	actualFilePath, err := filepath.Abs(targetFilePath)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	decryptedFilePath, err := filepath.Abs(filepath.Join(servicePath, filename))
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if _, err = os.Stat(decryptedFilePath); err == nil && !overwrite {
-		return fmt.Errorf("an decrypted file already exists, specify -o to overwrite it")
-	}
-
-	var cmd *exec.Cmd = nil
-	if fileType == "" {
-		cmd = exec.Command("sops", "-d", actualFilePath)
-	} else {
-		cmd = exec.Command("sops", "--input-type", fileType, "--output-type", fileType,
-			"-d", actualFilePath)
+		return "", ErrDecryptedFileExists
 	}
 
-	if _, err := GetSopsAgeKeyPath(); err != nil {
-		return err
+	if err := CheckDecryptIdentity(actualFilePath); err != nil {
+		return "", err
 	}
 
 	if lineEnding, err := DetectLineEnding(actualFilePath); err != nil {
-		return fmt.Errorf("error detecting line ending: %v", err)
-	} else if lineEnding == CRLF {
-		return fmt.Errorf("sops does not support decrypting files with CRLF line endings, please convert it to LF line endings first")
+		return "", fmt.Errorf("error detecting line ending: %v", err)
+	} else if lineEnding == CRLF || lineEnding == Mixed {
+		fmt.Fprintf(os.Stderr, "Warning: %s has %s line endings, it is decrypted as LF, run 'composectl secrets fix-eol' to fix it\n",
+			actualFilePath, GetLineEndingString(lineEnding))
 	} else if lineEnding == Unknown {
 		fmt.Fprintf(os.Stderr, "Warning: the line ending of %s is unknown, it may not be decrypted correctly\n", actualFilePath)
 	}
 
-	if out, err := cmd.Output(); err != nil {
-		fmt.Println("Unable to decrypt file:", err, cmd)
-	} else {
-		// 1. Create the file.
-		file, err := os.Create(decryptedFilePath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to create file for %s: %v\n", filename, err)
-		}
+	out, err := DecryptToMemory(actualFilePath)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt file: %v", err)
+	}
 
-		// 2. Use `defer` to ensure the file is closed.
-		defer file.Close()
+	// 1. Create the file.
+	decryptedFile, err := os.Create(decryptedFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file for %s: %v", filename, err)
+	}
 
-		// 3. Write the content to the file.
-		_, err = file.Write(out)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to write to file: %v\n", err)
-		}
+	// 2. Use `defer` to ensure the file is closed.
+	defer decryptedFile.Close()
 
-		fmt.Printf("File %s decrypted successfully\n", filename)
+	// 3. Write the content to the file.
+	if _, err = decryptedFile.Write(out); err != nil {
+		return "", fmt.Errorf("failed to write to file: %v", err)
 	}
-	return nil
+
+	// Without a baseline, the sync state falls back to the timestamps
+	recordSyncBaseline(decryptedFilePath, out, actualFilePath)
+
+	return filename, nil
+}
+
+// DecryptToMemory decrypts the encrypted file with sops and returns the
+// plaintext content without writing the decrypted file to disk
+func DecryptToMemory(encryptedFilePath string) ([]byte, error) {
+	return DecryptToMemoryAs(encryptedFilePath, GetEncryptedFileType(encryptedFilePath))
+}
+
+// DecryptToMemoryAs is DecryptToMemory with an explicit sops file type, for
+// encrypted files whose name doesn't tell the format, such as the temporary
+// files git passes to a merge driver
+//
+// An encrypted file with CRLF or mixed line endings, usually converted by
+// git on Windows, is normalized to LF in memory before it is decrypted,
+// as sops fails to verify it otherwise.
+func DecryptToMemoryAs(encryptedFilePath string, fileType string) ([]byte, error) {
+	content, err := os.ReadFile(encryptedFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if fileType != "" && bytes.Contains(content, []byte("\r\n")) {
+		return runSopsWithInput([]string{"--input-type", fileType, "--output-type", fileType, "-d"},
+			NormalizeLineEnding(content))
+	}
+
+	var cmd *exec.Cmd = nil
+	if fileType == "" {
+		cmd = exec.Command("sops", "-d", encryptedFilePath)
+	} else {
+		cmd = exec.Command("sops", "--input-type", fileType, "--output-type", fileType,
+			"-d", encryptedFilePath)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, sopsError(err)
+	}
+
+	return out, nil
+}
+
+// DecryptedFilePath returns the absolute path of the decrypted counterpart
+// of the given encrypted service file, whether it exists or not
+func DecryptedFilePath(repoRoot string, name string, file ServiceFile) string {
+	var servicePath string = filepath.Join(repoRoot, config.DockerServicesDir, name)
+	_, filename := parseEncFilename(filepath.Join(servicePath, file.Filename), file.Filename)
+
+	return filepath.Join(servicePath, filename)
+}
+
+// GetEncryptedFileType returns the sops file type of an encrypted file
+// derived from its filename, "binary" when the format is not recognized
+func GetEncryptedFileType(encryptedFilePath string) string {
+	fileType, _ := parseEncFilename(encryptedFilePath, filepath.Base(encryptedFilePath))
+	return fileType
 }
 
 func parseEncFilename(targetFilePath string, file string) (fileType string, decryptedFilename string) {
@@ -156,10 +225,10 @@ func parseEncFilename(targetFilePath string, file string) (fileType string, decr
 		decryptedFilename = strings.TrimSuffix(file, ".ini.enc") + ".ini"
 
 	case strings.HasSuffix(targetFilePath, ".enc.pem"):
-		fileType = ""
-		decryptedFilename = strings.TrimSuffix(file, ".pem.ini") + ".pem"
+		fileType = "binary"
+		decryptedFilename = strings.TrimSuffix(file, ".enc.pem") + ".pem"
 	case strings.HasSuffix(targetFilePath, ".pem.enc"):
-		fileType = ""
+		fileType = "binary"
 		decryptedFilename = strings.TrimSuffix(file, ".pem.enc") + ".pem"
 
 	default:
@@ -175,7 +244,9 @@ func parseEncFilename(targetFilePath string, file string) (fileType string, decr
 			decryptedFilename = file
 		}
 
-		fileType = ""
+		// Certificates, keystores, databases and any other format that
+		// sops can't parse are stored as is, so they keep every byte
+		fileType = "binary"
 	}
 
 	return fileType, decryptedFilename
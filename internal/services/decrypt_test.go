@@ -0,0 +1,74 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseEncFilename(t *testing.T) {
+	var tests = []struct {
+		file          string
+		wantType      string
+		wantDecrypted string
+	}{
+		{".env.enc", "dotenv", ".env"},
+		{"app.env.enc", "dotenv", "app.env"},
+		{"config.enc.yml", "yaml", "config.yml"},
+		{"config.enc.yaml", "yaml", "config.yaml"},
+		{"config.yml.enc", "yaml", "config.yml"},
+		{"config.yaml.enc", "yaml", "config.yaml"},
+		{"config.enc.toml", "toml", "config.toml"},
+		{"config.toml.enc", "toml", "config.toml"},
+		{"config.enc.json", "json", "config.json"},
+		{"config.json.enc", "json", "config.json"},
+		{"config.enc.ini", "ini", "config.ini"},
+		{"config.ini.enc", "ini", "config.ini"},
+		{"cert.enc.pem", "binary", "cert.pem"},
+		{"cert.pem.enc", "binary", "cert.pem"},
+		{"keystore.p12.enc", "binary", "keystore.p12"},
+		{"notes.enc.txt", "binary", "notes.txt"},
+		{"plain.txt", "binary", "plain.txt"},
+		{filepath.Join("certs", "tls.key.enc"), "binary", filepath.Join("certs", "tls.key")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			var targetFilePath string = filepath.Join("docker_services", "gitea", test.file)
+			fileType, decryptedFilename := parseEncFilename(targetFilePath, test.file)
+			if fileType != test.wantType || decryptedFilename != test.wantDecrypted {
+				t.Errorf("parseEncFilename(%q) = %q, %q, want %q, %q", test.file, fileType, decryptedFilename,
+					test.wantType, test.wantDecrypted)
+			}
+		})
+	}
+}
+
+func TestGetEncryptedFileType(t *testing.T) {
+	var tests = map[string]string{
+		"/repo/docker_services/gitea/.env.enc":        "dotenv",
+		"/repo/docker_services/gitea/app.enc.yaml":    "yaml",
+		"/repo/docker_services/gitea/certs/a.pem.enc": "binary",
+	}
+
+	for path, want := range tests {
+		if got := GetEncryptedFileType(path); got != want {
+			t.Errorf("GetEncryptedFileType(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+type diffOpKind int
+
+const (
+	diffEqual diffOpKind = iota
+	diffDelete
+	diffInsert
+)
+
+type diffOp struct {
+	kind diffOpKind
+	line string
+}
+
+type KeyChange int
+
+const (
+	KeyAdded KeyChange = iota
+	KeyRemoved
+	KeyChanged
+)
+
+// KeyDiff is a single key level difference between two structured secrets
+type KeyDiff struct {
+	Key      string
+	Change   KeyChange
+	OldValue string
+	NewValue string
+}
+
+// SecretDiff is the difference between the decrypted content of an
+// encrypted file and its decrypted working file
+type SecretDiff struct {
+	Unified string
+	// MaskedUnified is the unified diff with the secret values masked
+	MaskedUnified string
+	// Keys is only available when IsStructured is true
+	Keys         []KeyDiff
+	IsStructured bool
+}
+
+// DiffSecretFile decrypts the encrypted service file in memory and compares
+// it with its decrypted working file. The format used for the key level
+// diff is derived from the encrypted filename.
+func DiffSecretFile(repoRoot string, name string, file ServiceFile) (SecretDiff, error) {
+	var servicePath string = filepath.Join(repoRoot, config.DockerServicesDir, name)
+	var encryptedFilePath string = filepath.Join(servicePath, file.Filename)
+	var decryptedFilePath string = DecryptedFilePath(repoRoot, name, file)
+
+	workingContent, err := os.ReadFile(decryptedFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return SecretDiff{}, fmt.Errorf("%s has not been decrypted", file.Filename)
+		}
+		return SecretDiff{}, fmt.Errorf("unable to read %s: %v", decryptedFilePath, err)
+	}
+
+	encryptedContent, err := DecryptToMemory(encryptedFilePath)
+	if err != nil {
+		return SecretDiff{}, fmt.Errorf("unable to decrypt %s: %v", file.Filename, err)
+	}
+
+	decryptedFilename, err := filepath.Rel(servicePath, decryptedFilePath)
+	if err != nil {
+		decryptedFilename = decryptedFilePath
+	}
+
+	var fromName string = "a/" + filepath.ToSlash(file.Filename)
+	var toName string = "b/" + filepath.ToSlash(decryptedFilename)
+	fileType, _ := parseEncFilename(encryptedFilePath, file.Filename)
+
+	var diff SecretDiff = SecretDiff{
+		Unified:       UnifiedDiff(fromName, toName, encryptedContent, workingContent, 3),
+		MaskedUnified: MaskedUnifiedDiff(fromName, toName, encryptedContent, workingContent, 3, fileType),
+	}
+
+	if !IsStructuredFileType(fileType) {
+		return diff, nil
+	}
+
+	encryptedKeys, err := FlattenStructuredSecret(encryptedContent, fileType)
+	if err != nil {
+		return diff, nil
+	}
+	workingKeys, err := FlattenStructuredSecret(workingContent, fileType)
+	if err != nil {
+		// The working file may be mid-edit, the line diff is still useful
+		return diff, nil
+	}
+
+	diff.Keys = DiffKeys(encryptedKeys, workingKeys)
+	diff.IsStructured = true
+	return diff, nil
+}
+
+// UnifiedDiff returns the unified diff of two file content with the
+// given number of context lines, or an empty string when both content
+// are the same (ignoring the difference in line endings)
+func UnifiedDiff(fromName string, toName string, from []byte, to []byte, context int) string {
+	return unifiedDiff(fromName, toName, from, to, context, nil)
+}
+
+// MaskedUnifiedDiff is UnifiedDiff with the secret values of the diff
+// lines masked according to the sops file type, see MaskSecretLine
+func MaskedUnifiedDiff(fromName string, toName string, from []byte, to []byte, context int, fileType string) string {
+	return unifiedDiff(fromName, toName, from, to, context, func(line string) string {
+		return MaskSecretLine(line, fileType)
+	})
+}
+
+func unifiedDiff(fromName string, toName string, from []byte, to []byte, context int, mask func(string) string) string {
+	var fromLines []string = splitLines(from)
+	var toLines []string = splitLines(to)
+
+	var ops []diffOp = diffLines(fromLines, toLines)
+
+	var builder strings.Builder
+	var fromLine, toLine int = 1, 1
+	var index int = 0
+	for index < len(ops) {
+		// Skip to the next change
+		if ops[index].kind == diffEqual {
+			fromLine++
+			toLine++
+			index++
+			continue
+		}
+
+		// Include the leading context of the hunk
+		var start int = max(index-context, 0)
+		var hunkFromStart int = fromLine - (index - start)
+		var hunkToStart int = toLine - (index - start)
+
+		// Extend the hunk until there are more than 2*context equal lines
+		var end int = index
+		var equalRun int = 0
+		for end < len(ops) && equalRun <= context*2 {
+			if ops[end].kind == diffEqual {
+				equalRun++
+			} else {
+				equalRun = 0
+			}
+			end++
+		}
+		// Trim the trailing context to at most context lines
+		if equalRun > context {
+			end -= equalRun - context
+		}
+
+		var hunk strings.Builder
+		var fromCount, toCount int = 0, 0
+		for _, op := range ops[start:end] {
+			var line string = op.line
+			if mask != nil {
+				line = mask(line)
+			}
+
+			switch op.kind {
+			case diffEqual:
+				hunk.WriteString(" " + line + "\n")
+				fromCount++
+				toCount++
+			case diffDelete:
+				hunk.WriteString("-" + line + "\n")
+				fromCount++
+			case diffInsert:
+				hunk.WriteString("+" + line + "\n")
+				toCount++
+			}
+		}
+
+		if builder.Len() == 0 {
+			fmt.Fprintf(&builder, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&builder, "@@ -%s +%s @@\n", hunkRange(hunkFromStart, fromCount), hunkRange(hunkToStart, toCount))
+		builder.WriteString(hunk.String())
+
+		// Advance the line counter through the ops consumed by the hunk
+		for _, op := range ops[index:end] {
+			if op.kind != diffInsert {
+				fromLine++
+			}
+			if op.kind != diffDelete {
+				toLine++
+			}
+		}
+		index = end
+	}
+
+	return builder.String()
+}
+
+// DiffKeys compares two flattened structured secrets and returns the
+// added, removed and changed keys sorted by the key name
+func DiffKeys(from map[string]string, to map[string]string) []KeyDiff {
+	var diffs []KeyDiff
+
+	for key, oldValue := range from {
+		newValue, ok := to[key]
+		if !ok {
+			diffs = append(diffs, KeyDiff{Key: key, Change: KeyRemoved, OldValue: oldValue})
+		} else if oldValue != newValue {
+			diffs = append(diffs, KeyDiff{Key: key, Change: KeyChanged, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+
+	for key, newValue := range to {
+		if _, ok := from[key]; !ok {
+			diffs = append(diffs, KeyDiff{Key: key, Change: KeyAdded, NewValue: newValue})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Key < diffs[j].Key
+	})
+
+	return diffs
+}
+
+// MaskSecretValue hides a secret value while still showing whether
+// it is empty, so that the diff remains useful without leaking it
+func MaskSecretValue(value string) string {
+	if value == "" {
+		return "(empty)"
+	}
+	return "********"
+}
+
+var (
+	// KEY=value of dotenv, and key = value of ini and toml
+	assignmentLinePattern = regexp.MustCompile(`^(\s*(?:export\s+)?[^\s=#;\[][^=]*?\s*=\s*)(.*)$`)
+	// key: value, where the key may be a list item or quoted
+	yamlKeyLinePattern  = regexp.MustCompile(`^(\s*(?:-\s+)*(?:"[^"]*"|'[^']*'|[^\s#:"'-][^:#]*?):)(?:\s+(.*))?$`)
+	yamlItemLinePattern = regexp.MustCompile(`^(\s*(?:-\s+)+)(.*)$`)
+	// "key": value with an optional trailing comma
+	jsonKeyLinePattern = regexp.MustCompile(`^(\s*"(?:[^"\\]|\\.)*"\s*:\s*)(.*?)(,?)\s*$`)
+	// Lines that only hold the document structure, such as the brackets
+	// of json or the document markers of yaml
+	structureLinePattern = regexp.MustCompile(`^\s*(?:[\[\]{},]*|---|\.\.\.)\s*$`)
+	// [section] of ini and [table] or [[array]] of toml
+	sectionLinePattern = regexp.MustCompile(`^\s*\[\[?[^\]=]*\]\]?\s*$`)
+)
+
+// MaskSecretLine masks the secret value of a single line of a decrypted
+// secret. The key of dotenv, ini, toml, yaml and json lines and the
+// structure of the document are kept so that a masked diff still shows
+// which keys have changed, any other line is masked as a whole.
+func MaskSecretLine(line string, fileType string) string {
+	if structureLinePattern.MatchString(line) {
+		return line
+	}
+
+	var indentation string = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+
+	switch fileType {
+	case "dotenv", "ini", "toml":
+		if fileType != "dotenv" && sectionLinePattern.MatchString(line) {
+			return line
+		}
+		if match := assignmentLinePattern.FindStringSubmatch(line); match != nil {
+			return match[1] + maskLineValue(match[2])
+		}
+	case "yaml":
+		if match := yamlKeyLinePattern.FindStringSubmatch(line); match != nil {
+			if strings.TrimSpace(match[2]) == "" {
+				// A key that holds a nested mapping or list
+				return line
+			}
+			return match[1] + " " + maskLineValue(match[2])
+		}
+		if match := yamlItemLinePattern.FindStringSubmatch(line); match != nil {
+			return match[1] + maskLineValue(match[2])
+		}
+	case "json":
+		if match := jsonKeyLinePattern.FindStringSubmatch(line); match != nil {
+			if match[2] == "{" || match[2] == "[" {
+				return line
+			}
+			return match[1] + maskLineValue(match[2]) + match[3]
+		}
+		var value string = strings.TrimSpace(line)
+		if strings.HasSuffix(value, ",") {
+			return indentation + maskLineValue(strings.TrimSuffix(value, ",")) + ","
+		}
+	}
+
+	return indentation + MaskSecretValue(strings.TrimSpace(line))
+}
+
+// maskLineValue masks a value that may be quoted, so that an empty
+// quoted value is still shown as empty
+func maskLineValue(value string) string {
+	value = strings.TrimSpace(value)
+	if value == `""` || value == "''" {
+		value = ""
+	}
+	return MaskSecretValue(value)
+}
+
+func splitLines(content []byte) []string {
+	var text string = strings.ReplaceAll(string(content), "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes the line operations that transform from into to
+// using the longest common subsequence of both. Secret files are small
+// so the quadratic table is not a concern.
+func diffLines(from []string, to []string) []diffOp {
+	var lcs [][]int = make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	var i, j int = 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			ops = append(ops, diffOp{kind: diffEqual, line: from[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{kind: diffDelete, line: from[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: diffInsert, line: to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		ops = append(ops, diffOp{kind: diffDelete, line: from[i]})
+	}
+	for ; j < len(to); j++ {
+		ops = append(ops, diffOp{kind: diffInsert, line: to[j]})
+	}
+
+	return ops
+}
+
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		// An empty range refers to the line before the hunk
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
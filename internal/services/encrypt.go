@@ -17,84 +17,281 @@ limitations under the License.
 package services
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 )
 
-func EncryptFile(targetFile string, publicKey string, overwrite bool) error {
-	var encryptedFile string = targetFile + ".enc"
-	var cmd = exec.Command("sops", "--encrypt", "--age", publicKey, targetFile)
+// EncryptOptions controls the recipients used to encrypt a file
+type EncryptOptions struct {
+	// The age public keys to encrypt to. Ignored when SopsConfigPath is set
+	Recipients []string
+	// The URIs of the HashiCorp Vault transit keys to encrypt to, in
+	// addition to the age recipients. Ignored when SopsConfigPath is set
+	HcVaultTransitUris []string
+	// The PGP fingerprints, AWS KMS ARNs, GCP KMS resource IDs and Azure
+	// Key Vault key URLs to encrypt to, only used to keep the keys of an
+	// existing secret. Ignored when SopsConfigPath is set
+	PgpFingerprints   []string
+	KmsArns           []string
+	GcpKmsResourceIds []string
+	AzureKeyVaultUrls []string
+	// The path to the .sops.yaml file. When set, the recipients and the
+	// encryption settings of its matching creation rule are applied by
+	// sops, so the result is identical to running sops directly.
+	SopsConfigPath string
+	Overwrite      bool
+	// Only the keys matching this regex are encrypted, yaml and json only
+	EncryptedRegex string
+	// The keys ending with this suffix are left unencrypted, yaml and json only
+	UnencryptedSuffix string
+}
+
+// validate checks that the partial encryption options are supported by
+// the file type and that at most one of them is set
+func (o EncryptOptions) validate(fileType string) error {
+	if o.EncryptedRegex == "" && o.UnencryptedSuffix == "" {
+		return nil
+	}
+
+	if o.EncryptedRegex != "" && o.UnencryptedSuffix != "" {
+		return fmt.Errorf("the encrypted regex and the unencrypted suffix can't be used together")
+	}
+	if fileType != "yaml" && fileType != "json" {
+		return fmt.Errorf("partial encryption is only supported for yaml and json files, not %s", fileType)
+	}
+	if o.EncryptedRegex != "" {
+		if _, err := regexp.Compile(o.EncryptedRegex); err != nil {
+			return fmt.Errorf("invalid encrypted regex: %v", err)
+		}
+	}
+
+	return nil
+}
 
-	if _, err := os.Stat(encryptedFile); err == nil && !overwrite {
+// MasterKeys returns the age recipients followed by the master keys of the
+// other types, in the format of SopsMetadata.MasterKeys
+func (o EncryptOptions) MasterKeys() []string {
+	var keys []string = slices.Clone(o.Recipients)
+	for _, other := range [][]string{o.PgpFingerprints, o.KmsArns, o.HcVaultTransitUris, o.GcpKmsResourceIds, o.AzureKeyVaultUrls} {
+		keys = append(keys, other...)
+	}
+	return keys
+}
+
+// keyArgs returns the sops arguments of the age recipients, the Vault
+// transit keys and the other master keys to encrypt to
+func (o EncryptOptions) keyArgs() ([]string, error) {
+	var keyFlags = []struct {
+		flag string
+		keys []string
+	}{
+		{"--age", o.Recipients},
+		{"--hc-vault-transit", o.HcVaultTransitUris},
+		{"--pgp", o.PgpFingerprints},
+		{"--kms", o.KmsArns},
+		{"--gcp-kms", o.GcpKmsResourceIds},
+		{"--azure-kv", o.AzureKeyVaultUrls},
+	}
+
+	var args []string
+	for _, keyFlag := range keyFlags {
+		if len(keyFlag.keys) > 0 {
+			args = append(args, keyFlag.flag, strings.Join(keyFlag.keys, ","))
+		}
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no age public key or Vault transit key to encrypt with")
+	}
+	return args, nil
+}
+
+func EncryptFile(targetFile string, options EncryptOptions) error {
+	return EncryptFileTo(targetFile, targetFile+".enc", options)
+}
+
+// EncryptFileTo encrypts the plaintext targetFile into encryptedFile. The
+// sops input and output type is derived from the encrypted filename, so
+// that re-encrypting to an existing "config.enc.yaml" keeps its format.
+// A file of an unknown format is encrypted in binary mode, which
+// preserves every byte of it.
+func EncryptFileTo(targetFile string, encryptedFile string, options EncryptOptions) error {
+	if _, err := os.Stat(encryptedFile); err == nil && !options.Overwrite {
 		return fmt.Errorf("an encrypted file already exists, specify -o to overwrite it")
 	}
 
-	if out, err := cmd.Output(); err != nil {
-		return fmt.Errorf("unable to encrypt file: %v", err)
-	} else {
+	fileType, _ := parseEncFilename(encryptedFile, filepath.Base(encryptedFile))
+	if err := options.validate(fileType); err != nil {
+		return err
+	}
 
-		// 1. Create the file.
-		file, err := os.Create(encryptedFile)
+	var args []string
+	if options.SopsConfigPath != "" {
+		args = append(args, "--config", options.SopsConfigPath)
+	}
+	if fileType != "" {
+		args = append(args, "--input-type", fileType, "--output-type", fileType)
+	}
+	if options.EncryptedRegex != "" {
+		args = append(args, "--encrypted-regex", options.EncryptedRegex)
+	}
+	if options.UnencryptedSuffix != "" {
+		args = append(args, "--unencrypted-suffix", options.UnencryptedSuffix)
+	}
+	args = append(args, "--encrypt")
+	if options.SopsConfigPath == "" {
+		keyArgs, err := options.keyArgs()
 		if err != nil {
-			return fmt.Errorf("failed to create file for %s: %v", encryptedFile, err)
+			return fmt.Errorf("unable to encrypt %s: %v", targetFile, err)
 		}
+		args = append(args, keyArgs...)
+	}
+	args = append(args, targetFile)
 
-		// 2. Use `defer` to ensure the file is closed.
-		defer file.Close()
+	var cmd *exec.Cmd = exec.Command("sops", args...)
+	if options.SopsConfigPath != "" {
+		// sops matches path_regex relative to the config directory
+		cmd.Dir = filepath.Dir(options.SopsConfigPath)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("unable to encrypt file: %v", sopsError(err))
+	}
+
+	// 1. Create the file.
+	file, err := os.Create(encryptedFile)
+	if err != nil {
+		return fmt.Errorf("failed to create file for %s: %v", encryptedFile, err)
+	}
+
+	// 2. Use `defer` to ensure the file is closed.
+	defer file.Close()
 
-		// 3. Write the content to the file.
-		_, err = file.Write(out)
+	// 3. Write the content to the file.
+	_, err = file.Write(out)
+	if err != nil {
+		return fmt.Errorf("failed to write to file: %v", err)
+	}
+
+	// Without a baseline, the sync state falls back to the timestamps
+	if plaintext, err := os.ReadFile(targetFile); err == nil {
+		recordSyncBaseline(targetFile, plaintext, encryptedFile)
+	}
+
+	fmt.Printf("File %s encrypted successfully\n", encryptedFile)
+	return nil
+}
+
+// EncryptBytes encrypts the plaintext content of the given sops file type
+// to the recipients of the options and returns the encrypted content,
+// without writing the plaintext to the disk except on Windows.
+func EncryptBytes(content []byte, fileType string, options EncryptOptions) ([]byte, error) {
+	keyArgs, err := options.keyArgs()
+	if err != nil {
+		return nil, err
+	}
+	if err := options.validate(fileType); err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if fileType != "" {
+		args = append(args, "--input-type", fileType, "--output-type", fileType)
+	}
+	if options.EncryptedRegex != "" {
+		args = append(args, "--encrypted-regex", options.EncryptedRegex)
+	}
+	if options.UnencryptedSuffix != "" {
+		args = append(args, "--unencrypted-suffix", options.UnencryptedSuffix)
+	}
+	args = append(args, "--encrypt")
+	args = append(args, keyArgs...)
+
+	out, err := runSopsWithInput(args, content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt: %v", err)
+	}
+
+	return out, nil
+}
+
+func GetPublicKeyFromDefaultLocation() (string, error) {
+	publicKeys, err := GetPublicKeysFromDefaultLocation()
+	if err != nil {
+		return "", err
+	}
+	return publicKeys[0], nil
+}
+
+// GetPublicKeysFromDefaultLocation returns the public keys of every
+// identity in the keys.txt file, in the order they appear in the file,
+// followed by the public key of the SSH private key used by sops
+func GetPublicKeysFromDefaultLocation() ([]string, error) {
+	var publicKeys []string
+
+	keysPath, keysErr := GetSopsAgeKeyPath()
+	if keysErr == nil {
+		keys, err := extractPublicKeys(keysPath)
 		if err != nil {
-			return fmt.Errorf("failed to write to file: %v", err)
+			return nil, err
+		}
+		publicKeys = append(publicKeys, keys...)
+	}
+
+	if sshKeyPath, err := GetSopsAgeSshKeyPath(); err == nil {
+		if publicKey, err := readSshPublicKey(sshKeyPath); err == nil {
+			publicKeys = append(publicKeys, publicKey)
+		} else if keysErr != nil {
+			return nil, err
 		}
+	}
 
-		return fmt.Errorf("file %s encrypted successfully", encryptedFile)
+	if len(publicKeys) == 0 {
+		return nil, fmt.Errorf("error getting sops age key path: %v", keysErr)
 	}
+	return publicKeys, nil
 }
 
-func GetPublicKeyFromDefaultLocation() (string, error) {
-	keysPath, err := GetSopsAgeKeyPath()
+// readSshPublicKey reads the public key of the SSH private key from
+// the .pub file next to it, as written by ssh-keygen
+func readSshPublicKey(privateKeyPath string) (string, error) {
+	content, err := os.ReadFile(privateKeyPath + ".pub")
 	if err != nil {
-		return "", fmt.Errorf("error getting sops age key path: %v", err)
+		return "", fmt.Errorf("unable to read the public key of %s: %v", privateKeyPath, err)
 	}
-	return extractPublicKey(keysPath)
+
+	var publicKey string = strings.TrimSpace(string(content))
+	if err := ValidateAgeRecipient(publicKey); err != nil {
+		return "", err
+	}
+	return NormalizeAgeRecipient(publicKey), nil
 }
 
-func extractPublicKey(path string) (string, error) {
+func extractPublicKeys(path string) ([]string, error) {
 	if filepath.Ext(path) != ".txt" {
-		return "", fmt.Errorf("the provided file is not a txt file")
+		return nil, fmt.Errorf("the provided file is not a txt file")
 	}
 
-	// Open file
-	file, err := os.Open(path)
+	identities, err := ReadAgeIdentities(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return "", fmt.Errorf("unable to locate the age file: %w", err)
-		}
-		return "", fmt.Errorf("error opening age file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if strings.HasPrefix(line, "# public key:") {
-			pub := strings.TrimSpace(strings.TrimPrefix(line, "# public key:"))
-			if pub == "" {
-				return "", fmt.Errorf("public key line found but empty") // edge case
-			}
-			return pub, nil
+	var publicKeys []string
+	for _, identity := range identities {
+		// A plugin identity without a "# public key:" comment has no known public key
+		if identity.PublicKey != "" {
+			publicKeys = append(publicKeys, identity.PublicKey)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("error reading age file: %w", err)
+	if len(publicKeys) == 0 {
+		return nil, fmt.Errorf("public key not found in file")
 	}
-
-	// case 2: file exists but no public key line
-	return "", fmt.Errorf("public key not found in file")
+	return publicKeys, nil
 }
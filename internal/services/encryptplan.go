@@ -0,0 +1,217 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+type EncryptAction int
+
+const (
+	// The plaintext file has no encrypted counterpart yet
+	EncryptNew EncryptAction = iota
+	// The plaintext file was changed after it was last encrypted
+	EncryptModified
+	// The plaintext file can't be compared with its encrypted counterpart,
+	// usually because the private key isn't available, so it is left alone
+	EncryptSkipped
+)
+
+func (a EncryptAction) String() string {
+	switch a {
+	case EncryptNew:
+		return "new"
+	case EncryptModified:
+		return "modified"
+	case EncryptSkipped:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// EncryptPlanEntry is a plaintext secret found by PlanServiceEncryption
+type EncryptPlanEntry struct {
+	// The path relative to the service directory, with forward slashes
+	File           string
+	PlaintextPath  string
+	EncryptedPath  string
+	Action         EncryptAction
+	EncryptedState SecretSyncState
+}
+
+// SecretPatterns decides which plaintext files of a service are secrets,
+// either by glob patterns or by the path_regex of the .sops.yaml
+type SecretPatterns struct {
+	// Glob patterns, a pattern without a slash matches the filename in
+	// any directory, otherwise it matches the path relative to the service
+	Globs      []string
+	SopsConfig *SopsConfig
+}
+
+// Match reports whether the plaintext file at the given path, relative
+// to the service directory, is a secret
+func (p SecretPatterns) Match(servicePath string, relativePath string) (bool, error) {
+	relativePath = filepath.ToSlash(relativePath)
+
+	if len(p.Globs) > 0 {
+		for _, glob := range p.Globs {
+			var target string = relativePath
+			if !strings.Contains(glob, "/") {
+				target = path.Base(relativePath)
+			}
+
+			matched, err := path.Match(glob, target)
+			if err != nil {
+				return false, fmt.Errorf("invalid secret pattern %q: %v", glob, err)
+			}
+			if matched {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if p.SopsConfig != nil {
+		return p.SopsConfig.MatchesPathRegex(filepath.Join(servicePath, filepath.FromSlash(relativePath)))
+	}
+
+	return false, nil
+}
+
+// MatchesPathRegex reports whether the file matches the path_regex of any
+// creation rule. Unlike MatchCreationRule, a rule without a path_regex,
+// which would match every file, is ignored.
+func (c *SopsConfig) MatchesPathRegex(filePath string) (bool, error) {
+	relativePath, err := filepath.Rel(filepath.Dir(c.Path), filePath)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		relativePath = filePath
+	}
+	relativePath = filepath.ToSlash(relativePath)
+
+	for _, rule := range c.CreationRules {
+		if rule.PathRegex == "" {
+			continue
+		}
+
+		reg, err := regexp.Compile(rule.PathRegex)
+		if err != nil {
+			return false, fmt.Errorf("invalid path_regex %q in %s: %v", rule.PathRegex, c.Path, err)
+		}
+		if reg.MatchString(relativePath) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// PlanServiceEncryption finds the plaintext secrets of the service that
+// match the patterns and have no encrypted counterpart, or whose encrypted
+// counterpart is older than the plaintext. The secrets that are already
+// in sync are not returned.
+func PlanServiceEncryption(repoRoot string, name string, patterns SecretPatterns) ([]EncryptPlanEntry, error) {
+	var servicePath string = filepath.Join(repoRoot, config.DockerServicesDir, name)
+
+	files, err := ResolveServiceFiles(repoRoot, name, true)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving service's details: %v", err)
+	}
+
+	// The encrypted counterpart of every decrypted path
+	var encryptedFiles map[string]ServiceFile = make(map[string]ServiceFile)
+	for _, file := range files {
+		encryptedFiles[DecryptedFilePath(repoRoot, name, file)] = file
+	}
+
+	var entries []EncryptPlanEntry
+	err = filepath.WalkDir(servicePath, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			// Skip what can't be read, like the data directories that
+			// are owned by the container user
+			if os.IsPermission(err) {
+				if entry != nil && entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || IsEncryptedFile(filePath) {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(servicePath, filePath)
+		if err != nil {
+			return err
+		}
+		matched, err := patterns.Match(servicePath, relativePath)
+		if err != nil || !matched {
+			return err
+		}
+
+		file, hasEncrypted := encryptedFiles[filePath]
+		if !hasEncrypted {
+			entries = append(entries, EncryptPlanEntry{
+				File:          filepath.ToSlash(relativePath),
+				PlaintextPath: filePath,
+				EncryptedPath: filePath + ".enc",
+				Action:        EncryptNew,
+			})
+			return nil
+		}
+
+		state, _ := GetSecretSyncState(repoRoot, name, file)
+		var planEntry EncryptPlanEntry = EncryptPlanEntry{
+			File:           filepath.ToSlash(relativePath),
+			PlaintextPath:  filePath,
+			EncryptedPath:  filepath.Join(servicePath, file.Filename),
+			EncryptedState: state,
+		}
+
+		switch state {
+		case InSync, Stale:
+			// A stale plaintext is older than the encrypted file, encrypting
+			// it would discard the newer encrypted changes
+			return nil
+		case Modified:
+			planEntry.Action = EncryptModified
+		default:
+			planEntry.Action = EncryptSkipped
+		}
+		entries = append(entries, planEntry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to search the plaintext secrets of %s: %v", name, err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].File < entries[j].File
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+// LineEndingIssue is an encrypted file with CRLF or mixed line endings
+type LineEndingIssue struct {
+	Service    string
+	File       ServiceFile
+	LineEnding LineEnding
+}
+
+// FindLineEndingIssues returns the encrypted files of the given services
+// that have CRLF or mixed line endings
+func FindLineEndingIssues(repoRoot string, serviceNames []string) ([]LineEndingIssue, error) {
+	var issues []LineEndingIssue
+	for _, name := range serviceNames {
+		files, err := ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving service's details: %v", err)
+		}
+
+		for _, file := range files {
+			lineEnding, err := DetectLineEnding(filepath.Join(repoRoot, config.DockerServicesDir, name, file.Filename))
+			if err != nil {
+				return nil, fmt.Errorf("error detecting line ending: %v", err)
+			}
+			if lineEnding == CRLF || lineEnding == Mixed {
+				issues = append(issues, LineEndingIssue{Service: name, File: file, LineEnding: lineEnding})
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// FixLineEnding rewrites the file with LF line endings. The file is
+// replaced atomically, so a failure never leaves it half written.
+func FixLineEnding(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", path, err)
+	}
+
+	return writeFileAtomic(path, NormalizeLineEnding(content))
+}
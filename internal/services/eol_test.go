@@ -0,0 +1,86 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+func TestFindLineEndingIssues(t *testing.T) {
+	var repoRoot string = t.TempDir()
+	var files = map[string]string{
+		"gitea/.env.enc":         "A=ENC[1]\nsops_version=3.9.0\n",
+		"gitea/app.enc.yaml":     "a: ENC[1]\r\nsops:\r\n",
+		"nextcloud/.env.enc":     "A=ENC[1]\r\nsops_version=3.9.0\n",
+		"nextcloud/.env.example": "A=\r\n",
+	}
+	for file, content := range files {
+		var filePath string = filepath.Join(repoRoot, config.DockerServicesDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issues, err := FindLineEndingIssues(repoRoot, []string{"gitea", "nextcloud"})
+	if err != nil {
+		t.Fatalf("FindLineEndingIssues() error = %v", err)
+	}
+
+	var got map[string]LineEnding = make(map[string]LineEnding)
+	for _, issue := range issues {
+		got[issue.Service+"/"+filepath.ToSlash(issue.File.Filename)] = issue.LineEnding
+	}
+	var want map[string]LineEnding = map[string]LineEnding{
+		"gitea/app.enc.yaml": CRLF,
+		"nextcloud/.env.enc": Mixed,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("FindLineEndingIssues() = %v, want %v", got, want)
+	}
+	for file, lineEnding := range want {
+		if got[file] != lineEnding {
+			t.Errorf("FindLineEndingIssues() %s = %s, want %s", file, GetLineEndingString(got[file]),
+				GetLineEndingString(lineEnding))
+		}
+	}
+}
+
+func TestFixLineEnding(t *testing.T) {
+	var path string = filepath.Join(t.TempDir(), ".env.enc")
+	if err := os.WriteFile(path, []byte("A=ENC[1]\r\nsops_version=3.9.0\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := FixLineEnding(path); err != nil {
+		t.Fatalf("FixLineEnding() error = %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "A=ENC[1]\nsops_version=3.9.0\n"; string(content) != want {
+		t.Errorf("FixLineEnding() wrote %q, want %q", content, want)
+	}
+}
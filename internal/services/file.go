@@ -34,6 +34,8 @@ const (
 	Unknown LineEnding = iota
 	LF
 	CRLF
+	// Both LF and CRLF line endings are used in the same file
+	Mixed
 )
 
 // Regex for matching file names
@@ -44,40 +46,51 @@ const (
 // - compose.<anything>.yml
 var dockerComposeFileRegex = regexp.MustCompile(`^(docker[-_]compose|compose)(?:\.(.+))?\.yml$`)
 
+// DetectLineEnding reads the whole file to find the line endings it uses,
+// so that a file with mixed line endings is detected as Mixed
 func DetectLineEnding(path string) (LineEnding, error) {
-	file, err := os.Open(path)
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return Unknown, err
 	}
-	defer file.Close()
 
-	info, err := file.Stat()
-	if err != nil {
-		return Unknown, err
-	}
-	size := info.Size()
-	if size == 0 {
-		return Unknown, nil // empty file
-	}
+	return DetectContentLineEnding(content), nil
+}
 
-	readSize := int64(2)
-	if size < 2 {
-		readSize = size
+// DetectContentLineEnding returns the line endings used by the content,
+// or Unknown when it has no line break
+func DetectContentLineEnding(content []byte) LineEnding {
+	var crlfCount int = bytes.Count(content, []byte("\r\n"))
+	var lfCount int = bytes.Count(content, []byte("\n")) - crlfCount
+
+	switch {
+	case crlfCount > 0 && lfCount > 0:
+		return Mixed
+	case crlfCount > 0:
+		return CRLF
+	case lfCount > 0:
+		return LF
+	default:
+		return Unknown
 	}
+}
 
-	buf := make([]byte, readSize)
-	_, err = file.ReadAt(buf, size-readSize)
-	if err != nil {
-		return Unknown, err
-	}
+// NormalizeLineEnding converts every CRLF line ending of the content to LF
+func NormalizeLineEnding(content []byte) []byte {
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
 
-	if len(buf) >= 2 && buf[len(buf)-2] == '\r' && buf[len(buf)-1] == '\n' {
-		return CRLF, nil
-	} else if buf[len(buf)-1] == '\n' {
-		return LF, nil
+func GetLineEndingString(lineEnding LineEnding) string {
+	switch lineEnding {
+	case LF:
+		return "LF"
+	case CRLF:
+		return "CRLF"
+	case Mixed:
+		return "Mixed"
+	default:
+		return "Unknown"
 	}
-
-	return Unknown, nil
 }
 
 // Recursively finds Docker Compose files under startingPath
@@ -0,0 +1,89 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectContentLineEnding(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+		want    LineEnding
+	}{
+		{"empty", "", Unknown},
+		{"single line without a line break", "KEY=value", Unknown},
+		{"lone carriage return", "KEY=value\r", Unknown},
+		{"lf", "A=1\nB=2\n", LF},
+		{"lf without a trailing line break", "A=1\nB=2", LF},
+		{"crlf", "A=1\r\nB=2\r\n", CRLF},
+		{"crlf then lf", "A=1\r\nB=2\n", Mixed},
+		{"lf then crlf", "A=1\nB=2\r\n", Mixed},
+		{"carriage return in a value", "A=1\rX\nB=2\n", LF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectContentLineEnding([]byte(test.content)); got != test.want {
+				t.Errorf("DetectContentLineEnding(%q) = %s, want %s", test.content, GetLineEndingString(got),
+					GetLineEndingString(test.want))
+			}
+		})
+	}
+}
+
+func TestDetectLineEnding(t *testing.T) {
+	var path string = filepath.Join(t.TempDir(), ".env.enc")
+	if err := os.WriteFile(path, []byte("A=1\r\nB=2\nC=3\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	lineEnding, err := DetectLineEnding(path)
+	if err != nil {
+		t.Fatalf("DetectLineEnding() error = %v", err)
+	}
+	if lineEnding != Mixed {
+		t.Errorf("DetectLineEnding() = %s, want Mixed", GetLineEndingString(lineEnding))
+	}
+
+	if _, err := DetectLineEnding(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("DetectLineEnding() of a missing file, want an error")
+	}
+}
+
+func TestNormalizeLineEnding(t *testing.T) {
+	var tests = []struct {
+		content string
+		want    string
+	}{
+		{"", ""},
+		{"A=1\nB=2\n", "A=1\nB=2\n"},
+		{"A=1\r\nB=2\r\n", "A=1\nB=2\n"},
+		{"A=1\r\nB=2\nC=3", "A=1\nB=2\nC=3"},
+		{"A=1\r\r\n", "A=1\r\n"},
+		{"A=1\rB=2", "A=1\rB=2"},
+	}
+
+	for _, test := range tests {
+		if got := string(NormalizeLineEnding([]byte(test.content))); got != test.want {
+			t.Errorf("NormalizeLineEnding(%q) = %q, want %q", test.content, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The name of the git diff and merge driver registered by SetupGitIntegration
+const gitDriverName = "composectl"
+
+// The patterns of the encrypted files, matching IsEncryptedFile
+var gitAttributesPatterns = []string{"*.enc", "*.enc.*"}
+
+// SetupGitIntegration registers composectl as the diff textconv and the
+// merge driver of the encrypted files. The patterns are appended to the
+// .gitattributes of the repository, which is meant to be committed, and
+// the drivers are set in the local git config, which every clone has to
+// set up again. It is safe to run more than once.
+func SetupGitIntegration(repoRoot string, executable string) error {
+	var attributesPath string = filepath.Join(repoRoot, ".gitattributes")
+
+	content, err := os.ReadFile(attributesPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read %s: %v", attributesPath, err)
+	}
+
+	var existing map[string]bool = make(map[string]bool)
+	for _, line := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n") {
+		existing[strings.Join(strings.Fields(line), " ")] = true
+	}
+
+	var attributes string = string(content)
+	for _, pattern := range gitAttributesPatterns {
+		var line string = fmt.Sprintf("%s diff=%s merge=%s", pattern, gitDriverName, gitDriverName)
+		if existing[line] {
+			continue
+		}
+		if attributes != "" && !strings.HasSuffix(attributes, "\n") {
+			attributes += "\n"
+		}
+		attributes += line + "\n"
+	}
+
+	if attributes != string(content) {
+		if err := os.WriteFile(attributesPath, []byte(attributes), 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %v", attributesPath, err)
+		}
+	}
+
+	var quotedExecutable string = shellQuote(filepath.ToSlash(executable))
+	var gitConfig [][2]string = [][2]string{
+		{"diff." + gitDriverName + ".textconv", quotedExecutable + " git textconv"},
+		{"merge." + gitDriverName + ".name", "composectl sops encrypted file merge driver"},
+		{"merge." + gitDriverName + ".driver", quotedExecutable + " git merge-driver %O %A %B %P"},
+	}
+	for _, entry := range gitConfig {
+		cmd := exec.Command("git", "config", "--local", entry[0], entry[1])
+		cmd.Dir = repoRoot
+		if _, err := cmd.Output(); err != nil {
+			return fmt.Errorf("unable to set git config %s: %v", entry[0], gitError(err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// The marker written in the hooks installed by composectl, so that
+// they can be updated without overwriting a hook written by the user
+const hookMarker = "# Installed by composectl"
+
+// InstallPreCommitHook installs a git pre-commit hook that runs
+// 'composectl secrets scan --staged' with the given executable. An
+// existing hook that wasn't installed by composectl is only replaced
+// when force is true. The path of the installed hook is returned.
+func InstallPreCommitHook(repoRoot string, executable string, force bool) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--git-path", "hooks")
+	cmd.Dir = repoRoot
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to locate the git hooks directory: %v", gitError(err))
+	}
+
+	// The path is relative to the repository root unless core.hooksPath is absolute
+	var hooksDir string = strings.TrimSpace(string(out))
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(repoRoot, hooksDir)
+	}
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return "", fmt.Errorf("unable to create the git hooks directory: %v", err)
+	}
+
+	var hookPath string = filepath.Join(hooksDir, "pre-commit")
+	if content, err := os.ReadFile(hookPath); err == nil && !strings.Contains(string(content), hookMarker) && !force {
+		return "", fmt.Errorf("a pre-commit hook already exists at %s, use --force to replace it", hookPath)
+	}
+
+	var script string = fmt.Sprintf(`#!/bin/sh
+%s, do not edit.
+# Blocks committing decrypted secrets and plaintext credentials.
+# To bypass it for a single commit, use 'git commit --no-verify'.
+exec %s secrets scan --staged --repo-path "$(git rev-parse --show-toplevel)"
+`, hookMarker, shellQuote(filepath.ToSlash(executable)))
+
+	if err := os.WriteFile(hookPath, []byte(script), 0755); err != nil {
+		return "", fmt.Errorf("unable to write the pre-commit hook: %v", err)
+	}
+
+	return hookPath, nil
+}
+
+// shellQuote quotes a value as a single word for sh. Nothing is expanded
+// within single quotes, so a single quote is the only character to escape
+// by closing the quotes, escaping it and opening the quotes again.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,56 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	var tests = []struct {
+		value string
+		want  string
+	}{
+		{"/usr/local/bin/composectl", "'/usr/local/bin/composectl'"},
+		{"", "''"},
+		{"/home/me/my tools/composectl", "'/home/me/my tools/composectl'"},
+		{"/home/o'neil/composectl", `'/home/o'\''neil/composectl'`},
+		{`C:/Program Files/$bin/"composectl".exe`, `'C:/Program Files/$bin/"composectl".exe'`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			var got string = shellQuote(test.value)
+			if got != test.want {
+				t.Errorf("shellQuote(%q) = %s, want %s", test.value, got, test.want)
+			}
+
+			// The quoted value must be read back as is by sh
+			if _, err := exec.LookPath("sh"); err != nil {
+				return
+			}
+			out, err := exec.Command("sh", "-c", "printf %s "+got).Output()
+			if err != nil {
+				t.Fatalf("sh -c printf %%s %s error = %v", got, err)
+			}
+			if string(out) != test.value {
+				t.Errorf("sh read %s as %q, want %q", got, out, test.value)
+			}
+		})
+	}
+}
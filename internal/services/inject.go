@@ -0,0 +1,164 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+// InMemorySecrets holds the decrypted secrets of a service in a private
+// directory on a tmpfs, so that the plaintext never reaches the disk.
+// The decrypted path of every secret in the checkout is a symlink to its
+// tmpfs copy, so the compose file finds the secrets where it expects them.
+type InMemorySecrets struct {
+	// The private tmpfs directory holding the decrypted secrets
+	Dir string
+	// The tmpfs path of the service .env, to give to compose's --env-file
+	EnvFile string
+	// The decrypted secrets that already exist in the checkout and
+	// are used as they are
+	Existing []string
+
+	// The symlinks created in the checkout
+	links []string
+}
+
+// The tmpfs directories tried for the in-memory secrets, in order
+func tmpfsCandidates() []string {
+	var candidates []string
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, runtimeDir)
+	}
+	return append(candidates, "/dev/shm")
+}
+
+// PrepareInMemorySecrets decrypts every secret of the service into a
+// private tmpfs directory and links the decrypted paths in the checkout to
+// them. The caller must call Wipe once compose exits, even on error.
+func PrepareInMemorySecrets(repoRoot string, name string) (*InMemorySecrets, error) {
+	// Only Linux has a tmpfs that is guaranteed to be available
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("in-memory secrets are only supported on linux")
+	}
+
+	files, err := ResolveServiceFiles(repoRoot, name, true)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving service's details: %v", err)
+	}
+
+	var dir string = ""
+	for _, candidate := range tmpfsCandidates() {
+		if dir, err = os.MkdirTemp(candidate, "composectl-"); err == nil {
+			break
+		}
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("unable to create a private directory on a tmpfs: %v", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("unable to restrict the permission of %s: %v", dir, err)
+	}
+
+	var secrets *InMemorySecrets = &InMemorySecrets{Dir: dir}
+	var servicePath string = filepath.Join(repoRoot, config.DockerServicesDir, name)
+
+	for _, file := range files {
+		var decryptedPath string = DecryptedFilePath(repoRoot, name, file)
+		if _, err := os.Lstat(decryptedPath); err == nil {
+			secrets.Existing = append(secrets.Existing, decryptedPath)
+			continue
+		}
+
+		var encryptedFilePath string = filepath.Join(servicePath, file.Filename)
+		if err := CheckDecryptIdentity(encryptedFilePath); err != nil {
+			secrets.Wipe()
+			return nil, fmt.Errorf("unable to decrypt %s: %v", file.Filename, err)
+		}
+
+		content, err := DecryptToMemory(encryptedFilePath)
+		if err != nil {
+			secrets.Wipe()
+			return nil, fmt.Errorf("unable to decrypt %s: %v", file.Filename, err)
+		}
+
+		relativePath, err := filepath.Rel(servicePath, decryptedPath)
+		if err != nil {
+			secrets.Wipe()
+			return nil, err
+		}
+
+		var tmpfsPath string = filepath.Join(dir, relativePath)
+		if err := os.MkdirAll(filepath.Dir(tmpfsPath), 0700); err != nil {
+			secrets.Wipe()
+			return nil, fmt.Errorf("unable to create %s: %v", filepath.Dir(tmpfsPath), err)
+		}
+		if err := os.WriteFile(tmpfsPath, content, 0600); err != nil {
+			secrets.Wipe()
+			return nil, fmt.Errorf("unable to write %s: %v", tmpfsPath, err)
+		}
+
+		if err := os.Symlink(tmpfsPath, decryptedPath); err != nil {
+			secrets.Wipe()
+			return nil, fmt.Errorf("unable to link %s: %v", decryptedPath, err)
+		}
+		secrets.links = append(secrets.links, decryptedPath)
+
+		if relativePath == ".env" {
+			secrets.EnvFile = tmpfsPath
+		}
+	}
+
+	return secrets, nil
+}
+
+// Wipe removes the symlinks from the checkout and the tmpfs directory. The
+// decrypted secrets are unlinked rather than overwritten, as the running
+// containers still read the files that compose bind-mounted into them,
+// and the memory is released once the last container closes them. It
+// is safe to call more than once.
+func (s *InMemorySecrets) Wipe() error {
+	var errs []error
+
+	for _, link := range s.links {
+		// Never remove a file that replaced the symlink in the meantime
+		target, err := os.Readlink(link)
+		if err != nil || !strings.HasPrefix(target, s.Dir+string(filepath.Separator)) {
+			continue
+		}
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	s.links = nil
+
+	if err := os.RemoveAll(s.Dir); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to wipe the in-memory secrets: %v", errors.Join(errs...))
+	}
+	return nil
+}
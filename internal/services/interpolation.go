@@ -0,0 +1,336 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+type VariableModifier int
+
+const (
+	// ${VAR} or $VAR
+	VariablePlain VariableModifier = iota
+	// ${VAR:-default} or ${VAR-default}
+	VariableDefault
+	// ${VAR:?error} or ${VAR?error}
+	VariableRequired
+	// ${VAR:+alternate} or ${VAR+alternate}, empty when VAR is not set
+	VariableAlternate
+)
+
+// ComposeVariable is a variable interpolated in a compose file
+type ComposeVariable struct {
+	Name     string
+	Modifier VariableModifier
+	// The default value of a VariableDefault
+	Default string
+}
+
+// ExtractComposeVariables returns every variable interpolated in the values
+// of the compose file, including the ones nested in a default value, in the
+// order they appear. The comments, the keys and the "$$" escapes are skipped
+// the same way compose does.
+func ExtractComposeVariables(content []byte) ([]ComposeVariable, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	var variables []ComposeVariable
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		switch node.Kind {
+		case yaml.ScalarNode:
+			variables = append(variables, parseInterpolation(node.Value)...)
+		case yaml.MappingNode:
+			// Only the values are interpolated
+			for index := 1; index < len(node.Content); index += 2 {
+				walk(node.Content[index])
+			}
+		default:
+			for _, child := range node.Content {
+				walk(child)
+			}
+		}
+	}
+	walk(&document)
+
+	return variables, nil
+}
+
+func isVariableNameChar(char byte, first bool) bool {
+	return char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') ||
+		(!first && char >= '0' && char <= '9')
+}
+
+// parseInterpolation returns the variables interpolated in a single value
+func parseInterpolation(value string) []ComposeVariable {
+	var variables []ComposeVariable
+
+	for index := 0; index < len(value); index++ {
+		if value[index] != '$' || index+1 >= len(value) {
+			continue
+		}
+
+		var next byte = value[index+1]
+		switch {
+		case next == '$':
+			// Escaped dollar sign
+			index++
+		case isVariableNameChar(next, true):
+			var end int = index + 1
+			for end < len(value) && isVariableNameChar(value[end], false) {
+				end++
+			}
+			variables = append(variables, ComposeVariable{Name: value[index+1 : end], Modifier: VariablePlain})
+			index = end - 1
+		case next == '{':
+			// Find the matching closing brace, a default value may
+			// itself contain an interpolation
+			var depth int = 0
+			var end int = -1
+			for position := index + 1; position < len(value); position++ {
+				if value[position] == '{' {
+					depth++
+				} else if value[position] == '}' {
+					depth--
+					if depth == 0 {
+						end = position
+						break
+					}
+				}
+			}
+			if end == -1 {
+				return variables
+			}
+
+			var expression string = value[index+2 : end]
+			var nameEnd int = 0
+			for nameEnd < len(expression) && isVariableNameChar(expression[nameEnd], nameEnd == 0) {
+				nameEnd++
+			}
+			if nameEnd == 0 {
+				index = end
+				continue
+			}
+
+			var variable ComposeVariable = ComposeVariable{Name: expression[:nameEnd], Modifier: VariablePlain}
+			var operator string = strings.TrimPrefix(expression[nameEnd:], ":")
+			if operator != "" {
+				var rest string = operator[1:]
+				switch operator[0] {
+				case '-':
+					variable.Modifier = VariableDefault
+					variable.Default = rest
+				case '?':
+					variable.Modifier = VariableRequired
+				case '+':
+					variable.Modifier = VariableAlternate
+				}
+				variables = append(variables, variable)
+
+				// A variable nested in a default or an alternate value
+				// is only used depending on the outer variable
+				for _, nested := range parseInterpolation(rest) {
+					if nested.Modifier == VariablePlain || nested.Modifier == VariableRequired {
+						nested.Modifier = VariableAlternate
+					}
+					variables = append(variables, nested)
+				}
+			} else {
+				variables = append(variables, variable)
+			}
+			index = end
+		}
+	}
+
+	return variables
+}
+
+// VariableReport compares the variables interpolated in the compose files
+// of a directory with the keys of the .env compose reads them from
+type VariableReport struct {
+	// The .env relative to the service directory, with forward slashes
+	EnvFile string
+	// Where the keys were read from: the decrypted .env, the key names
+	// of the encrypted .env (which sops leaves in plaintext) or none
+	KeysSource string
+	// The compose files relative to the service directory
+	ComposeFiles []string
+	// The variables without a default that are not in the .env
+	Missing []ComposeVariable
+	// The variables with a default that are not in the .env, so the
+	// default value is used
+	Defaulted []ComposeVariable
+	// The keys of the .env that no compose file interpolates, only
+	// reported when the .env is not an env_file of any service
+	Unused []string
+}
+
+// CheckServiceVariables compares the variables interpolated in every
+// compose file of the service with the keys of the .env next to it.
+// Compose also reads the variables from the shell environment, which
+// is not taken into account.
+func CheckServiceVariables(repoRoot string, name string) ([]VariableReport, error) {
+	var servicePath string = filepath.Join(repoRoot, config.DockerServicesDir, name)
+
+	composeFiles, err := FindComposeFiles(servicePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the compose files of %s: %v", name, err)
+	}
+	sort.Strings(composeFiles)
+
+	// The compose files sharing the same .env, in order
+	var envFiles []string
+	var composeFilesByEnv map[string][]string = make(map[string][]string)
+	for _, composeFile := range composeFiles {
+		var envFile string = filepath.ToSlash(filepath.Join(filepath.Dir(composeFile), ".env"))
+		if _, ok := composeFilesByEnv[envFile]; !ok {
+			envFiles = append(envFiles, envFile)
+		}
+		composeFilesByEnv[envFile] = append(composeFilesByEnv[envFile], composeFile)
+	}
+
+	var reports []VariableReport
+	for _, envFile := range envFiles {
+		var report VariableReport = VariableReport{EnvFile: envFile, ComposeFiles: composeFilesByEnv[envFile]}
+
+		keys, source, err := readDotenvKeys(filepath.Join(servicePath, filepath.FromSlash(envFile)))
+		if err != nil {
+			return nil, err
+		}
+		report.KeysSource = source
+
+		// The variables by name, a variable is only defaulted when
+		// every interpolation of it has a default
+		var variables map[string]ComposeVariable = make(map[string]ComposeVariable)
+		var names []string
+		var usedAsEnvFile bool = false
+		for _, composeFile := range report.ComposeFiles {
+			content, err := os.ReadFile(filepath.Join(servicePath, composeFile))
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s: %v", composeFile, err)
+			}
+
+			extracted, err := ExtractComposeVariables(content)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse %s: %v", composeFile, err)
+			}
+			for _, variable := range extracted {
+				existing, ok := variables[variable.Name]
+				if !ok {
+					names = append(names, variable.Name)
+					variables[variable.Name] = variable
+				} else if variableRank(variable.Modifier) < variableRank(existing.Modifier) {
+					variables[variable.Name] = variable
+				}
+			}
+
+			references, err := ParseComposeReferences(servicePath, composeFile)
+			if err != nil {
+				return nil, err
+			}
+			for _, reference := range references {
+				if reference.Kind == RefEnvFile && reference.Path == envFile {
+					usedAsEnvFile = true
+				}
+			}
+		}
+
+		sort.Strings(names)
+		for _, variableName := range names {
+			if slices.Contains(keys, variableName) {
+				continue
+			}
+
+			var variable ComposeVariable = variables[variableName]
+			switch variable.Modifier {
+			case VariablePlain, VariableRequired:
+				report.Missing = append(report.Missing, variable)
+			case VariableDefault:
+				report.Defaulted = append(report.Defaulted, variable)
+			}
+		}
+
+		if !usedAsEnvFile {
+			for _, key := range keys {
+				if _, ok := variables[key]; !ok {
+					report.Unused = append(report.Unused, key)
+				}
+			}
+			sort.Strings(report.Unused)
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// variableRank orders the modifiers by how much the variable is needed,
+// so that the strongest interpolation of a variable is the one checked
+func variableRank(modifier VariableModifier) int {
+	switch modifier {
+	case VariableRequired, VariablePlain:
+		return 0
+	case VariableDefault:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// readDotenvKeys returns the keys of the decrypted .env, or the keys of
+// its encrypted counterpart when it isn't decrypted. The key names of
+// a sops encrypted dotenv file are in plaintext, so no key is needed.
+func readDotenvKeys(envPath string) ([]string, string, error) {
+	var source string = "decrypted"
+	content, err := os.ReadFile(envPath)
+	if os.IsNotExist(err) {
+		source = "encrypted"
+		content, err = os.ReadFile(envPath + ".enc")
+	}
+	if os.IsNotExist(err) {
+		return nil, "none", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read %s: %v", envPath, err)
+	}
+
+	var keys []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, _, ok := parseDotenvLine(scanner.Text())
+		if !ok || (source == "encrypted" && strings.HasPrefix(key, "sops_")) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, source, scanner.Err()
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseInterpolation(t *testing.T) {
+	var tests = []struct {
+		name  string
+		value string
+		want  []ComposeVariable
+	}{
+		{"no variable", "postgres:16", nil},
+		{"plain", "$DB_HOST", []ComposeVariable{{Name: "DB_HOST", Modifier: VariablePlain}}},
+		{"braced", "${DB_HOST}:5432", []ComposeVariable{{Name: "DB_HOST", Modifier: VariablePlain}}},
+		{"plain ends at a non name character", "$DB_HOST-replica", []ComposeVariable{{Name: "DB_HOST", Modifier: VariablePlain}}},
+		{"several", "$USER:${PASSWORD}@host", []ComposeVariable{
+			{Name: "USER", Modifier: VariablePlain},
+			{Name: "PASSWORD", Modifier: VariablePlain},
+		}},
+		{"default with colon", "${PORT:-8080}", []ComposeVariable{{Name: "PORT", Modifier: VariableDefault, Default: "8080"}}},
+		{"default without colon", "${PORT-8080}", []ComposeVariable{{Name: "PORT", Modifier: VariableDefault, Default: "8080"}}},
+		{"empty default", "${PORT:-}", []ComposeVariable{{Name: "PORT", Modifier: VariableDefault, Default: ""}}},
+		{"required", "${SECRET:?the secret is required}", []ComposeVariable{{Name: "SECRET", Modifier: VariableRequired}}},
+		{"required without colon", "${SECRET?missing}", []ComposeVariable{{Name: "SECRET", Modifier: VariableRequired}}},
+		{"alternate", "${DEBUG:+--verbose}", []ComposeVariable{{Name: "DEBUG", Modifier: VariableAlternate}}},
+		{"nested in a default", "${URL:-http://${HOST}:${PORT:-80}}", []ComposeVariable{
+			{Name: "URL", Modifier: VariableDefault, Default: "http://${HOST}:${PORT:-80}"},
+			{Name: "HOST", Modifier: VariableAlternate},
+			{Name: "PORT", Modifier: VariableDefault, Default: "80"},
+		}},
+		{"escaped dollar", "$$HOME", nil},
+		{"escaped dollar before a variable", "$$$HOME", []ComposeVariable{{Name: "HOME", Modifier: VariablePlain}}},
+		{"escaped braces", "$${HOME}", nil},
+		{"trailing dollar", "cost: 5$", nil},
+		{"digit after dollar", "$1", nil},
+		{"empty braces", "${}", nil},
+		{"invalid name in braces", "${1A}", nil},
+		{"unterminated braces", "${HOST", nil},
+		{"unterminated after a variable", "$USER ${HOST:-${PORT}", []ComposeVariable{{Name: "USER", Modifier: VariablePlain}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []ComposeVariable = parseInterpolation(test.value)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("parseInterpolation(%q) = %+v, want %+v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractComposeVariables(t *testing.T) {
+	var content string = `# ${COMMENTED}
+services:
+  app:
+    image: "app:${TAG:-latest}"
+    environment:
+      ${KEY_NOT_INTERPOLATED}: value
+      PASSWORD: $DB_PASSWORD
+    command: ["run", "--port", "${PORT}"]
+`
+	var want []ComposeVariable = []ComposeVariable{
+		{Name: "TAG", Modifier: VariableDefault, Default: "latest"},
+		{Name: "DB_PASSWORD", Modifier: VariablePlain},
+		{Name: "PORT", Modifier: VariablePlain},
+	}
+
+	got, err := ExtractComposeVariables([]byte(content))
+	if err != nil {
+		t.Fatalf("ExtractComposeVariables() error = %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ExtractComposeVariables() = %+v, want %+v", got, want)
+	}
+
+	if _, err := ExtractComposeVariables([]byte("services: [")); err == nil {
+		t.Errorf("ExtractComposeVariables() of invalid yaml, want an error")
+	}
+}
@@ -0,0 +1,497 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrMergeConflict is returned by MergeEncryptedFiles when both sides
+// changed the same key to different values
+var ErrMergeConflict = errors.New("merge conflict")
+
+// MergeEncryptedFiles performs a three-way merge of the sops encrypted
+// files given by git to a merge driver: the common ancestor (base), the
+// current version (current) and the version being merged (other).
+// The pathname is the path of the file in the repository, used to
+// determine the file type as the temporary files git creates have no
+// meaningful name. The merged keys must satisfy the secrets policy of the
+// service in the repository at repoRoot.
+//
+// The three versions are decrypted and merged key by key for dotenv,
+// yaml and json, the result is encrypted again and written to the
+// current file. On a conflict, the current file is left untouched and
+// the conflicting keys are returned with ErrMergeConflict.
+func MergeEncryptedFiles(repoRoot string, base string, current string, other string, pathname string) ([]string, error) {
+	var fileType string = GetEncryptedFileType(pathname)
+
+	basePlain, err := decryptMergeFile(base, fileType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the common ancestor: %v", err)
+	}
+	currentPlain, err := decryptMergeFile(current, fileType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the current version: %v", err)
+	}
+	otherPlain, err := decryptMergeFile(other, fileType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the other version: %v", err)
+	}
+
+	var merged []byte
+	var conflicts []string
+	switch {
+	case bytes.Equal(currentPlain, otherPlain) || bytes.Equal(basePlain, otherPlain):
+		merged = currentPlain
+	case bytes.Equal(basePlain, currentPlain):
+		merged = otherPlain
+	case fileType == "dotenv":
+		merged, conflicts = mergeDotenv(basePlain, currentPlain, otherPlain)
+	case fileType == "yaml" || fileType == "json":
+		merged, conflicts, err = mergeStructured(basePlain, currentPlain, otherPlain, fileType)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		// There are no keys to merge in other formats
+		return []string{filepath.Base(pathname)}, ErrMergeConflict
+	}
+
+	if len(conflicts) > 0 {
+		return conflicts, ErrMergeConflict
+	}
+
+	options, err := mergeEncryptOptions(base, current, other, fileType)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMergePolicy(repoRoot, pathname, options); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := EncryptBytes(merged, fileType, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, writeFileAtomic(current, encrypted)
+}
+
+// checkMergePolicy returns an error when the merged keys of a service secret
+// are not the recipients allowed by the secrets policy
+func checkMergePolicy(repoRoot string, pathname string, options EncryptOptions) error {
+	var parts []string = strings.Split(filepath.ToSlash(pathname), "/")
+	if len(parts) < 3 || parts[0] != config.DockerServicesDir {
+		return nil
+	}
+
+	policy, err := LoadSecretsPolicy(repoRoot)
+	if err != nil || !policy.HasRecipientsPolicy() {
+		return err
+	}
+	team, err := LoadTeamManifest(repoRoot)
+	if err != nil {
+		return err
+	}
+	return policy.CheckRecipients(parts[1], team, options.MasterKeys())
+}
+
+// decryptMergeFile decrypts a version of the file given to the merge
+// driver. A missing or empty file, which git passes as the ancestor of
+// a file added on both sides, is treated as an empty secret.
+func decryptMergeFile(path string, fileType string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, nil
+	}
+	return DecryptToMemoryAs(path, fileType)
+}
+
+// The sops settings the merge driver can't give to sops on the command
+// line, a version that uses them can't be encrypted again identically
+var unreproducibleSopsSettings = []string{
+	"key_groups", "shamir_threshold", "unencrypted_regex", "encrypted_suffix",
+	"encrypted_comment_regex", "unencrypted_comment_regex", "mac_only_encrypted",
+}
+
+// The fields of the AWS KMS keys that can't be given with --kms
+var unreproducibleKmsFields = []string{"role", "context", "aws_profile"}
+
+// mergeEncryptOptions merges the master keys of every type of the three
+// versions the same way as the keys, so that a recipient added or removed
+// on either side is kept added or removed in the merged file. The partial
+// encryption settings of the current version are kept.
+//
+// The metadata records the keys and the settings of the .sops.yaml creation
+// rule the file was encrypted with, so the rule isn't read again. The merge
+// fails when the current or the other version uses a setting that can't be
+// reproduced, such as key groups with a Shamir threshold.
+func mergeEncryptOptions(base string, current string, other string, fileType string) (EncryptOptions, error) {
+	var metadata [3]SopsMetadata
+	for index, path := range []string{base, current, other} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return EncryptOptions{}, err
+		}
+		if len(content) == 0 {
+			continue
+		}
+
+		flat, err := readFlatSopsMetadata(content, fileType)
+		if err != nil {
+			return EncryptOptions{}, fmt.Errorf("unable to parse the sops metadata: %v", err)
+		}
+		if index > 0 {
+			if setting := unreproducibleSopsSetting(flat); setting != "" {
+				return EncryptOptions{}, fmt.Errorf("the %s sops setting can't be kept by the merge driver, merge the decrypted files by hand", setting)
+			}
+		}
+		metadata[index] = metadataFromFlat(flat)
+	}
+
+	var mergeKeys = func(keys func(metadata SopsMetadata) []string) []string {
+		return mergeRecipients(keys(metadata[0]), keys(metadata[1]), keys(metadata[2]))
+	}
+
+	var options EncryptOptions = EncryptOptions{
+		EncryptedRegex:    metadata[1].EncryptedRegex,
+		UnencryptedSuffix: metadata[1].UnencryptedSuffix,
+
+		Recipients:         mergeKeys(func(m SopsMetadata) []string { return m.AgeRecipients }),
+		HcVaultTransitUris: mergeKeys(func(m SopsMetadata) []string { return m.HcVaultTransitUris }),
+		PgpFingerprints:    mergeKeys(func(m SopsMetadata) []string { return m.PgpFingerprints }),
+		KmsArns:            mergeKeys(func(m SopsMetadata) []string { return m.KmsArns }),
+		GcpKmsResourceIds:  mergeKeys(func(m SopsMetadata) []string { return m.GcpKmsResourceIds }),
+		AzureKeyVaultUrls:  mergeKeys(func(m SopsMetadata) []string { return m.AzureKeyVaultUrls }),
+	}
+
+	return options, nil
+}
+
+// unreproducibleSopsSetting returns the first setting of the flattened
+// metadata that can't be given to sops on the command line, if any
+func unreproducibleSopsSetting(flat map[string]string) string {
+	for _, setting := range unreproducibleSopsSettings {
+		for key, value := range flat {
+			if (key == setting || strings.HasPrefix(key, setting+sopsListSeparator)) && value != "" && value != "false" {
+				return setting
+			}
+		}
+	}
+
+	for _, field := range unreproducibleKmsFields {
+		for key, value := range flat {
+			if strings.HasPrefix(key, "kms"+sopsListSeparator) && strings.Contains(key, sopsMapSeparator+field) && value != "" {
+				return "kms " + field
+			}
+		}
+	}
+	return ""
+}
+
+// mergeRecipients keeps the current recipients, except the ones removed
+// by the other side, and adds the recipients added by the other side
+func mergeRecipients(baseRecipients []string, currentRecipients []string, otherRecipients []string) []string {
+	var recipients []string
+	for _, recipient := range currentRecipients {
+		// Removed by the other side
+		if slices.Contains(baseRecipients, recipient) && !slices.Contains(otherRecipients, recipient) {
+			continue
+		}
+		recipients = append(recipients, recipient)
+	}
+	for _, recipient := range otherRecipients {
+		// Added by the other side
+		if !slices.Contains(baseRecipients, recipient) && !slices.Contains(recipients, recipient) {
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients
+}
+
+// mergeValue merges a single value changed on either side, a nil value
+// means the key doesn't exist. It reports false when both sides changed
+// the value differently.
+func mergeValue[T any](base *T, current *T, other *T, equal func(a *T, b *T) bool) (*T, bool) {
+	switch {
+	case equal(current, other) || equal(base, other):
+		return current, true
+	case equal(base, current):
+		return other, true
+	default:
+		return current, false
+	}
+}
+
+type dotenvEntry struct {
+	key  string
+	line string
+	// The value is nil for the comments and empty lines
+	value *string
+}
+
+func parseDotenvEntries(content []byte) []dotenvEntry {
+	var entries []dotenvEntry
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		var line string = scanner.Text()
+		key, value, ok := parseDotenvLine(line)
+		if ok {
+			entries = append(entries, dotenvEntry{key: key, line: line, value: &value})
+		} else {
+			entries = append(entries, dotenvEntry{line: line})
+		}
+	}
+	return entries
+}
+
+func dotenvLookup(entries []dotenvEntry, key string) *dotenvEntry {
+	for index := range entries {
+		if entries[index].value != nil && entries[index].key == key {
+			return &entries[index]
+		}
+	}
+	return nil
+}
+
+// mergeDotenv merges the dotenv files key by key. The lines of the current
+// version are kept in place, the keys added by the other side are appended.
+func mergeDotenv(base []byte, current []byte, other []byte) ([]byte, []string) {
+	var baseEntries []dotenvEntry = parseDotenvEntries(base)
+	var currentEntries []dotenvEntry = parseDotenvEntries(current)
+	var otherEntries []dotenvEntry = parseDotenvEntries(other)
+
+	var equal = func(a *dotenvEntry, b *dotenvEntry) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return *a.value == *b.value
+	}
+
+	var conflicts []string
+	var lines []string
+	for _, entry := range currentEntries {
+		if entry.value == nil {
+			lines = append(lines, entry.line)
+			continue
+		}
+
+		merged, ok := mergeValue(dotenvLookup(baseEntries, entry.key), &entry, dotenvLookup(otherEntries, entry.key), equal)
+		if !ok {
+			conflicts = append(conflicts, entry.key)
+		}
+		if merged != nil {
+			lines = append(lines, merged.line)
+		}
+	}
+
+	for _, entry := range otherEntries {
+		if entry.value == nil || dotenvLookup(currentEntries, entry.key) != nil {
+			continue
+		}
+
+		merged, ok := mergeValue(dotenvLookup(baseEntries, entry.key), nil, &entry, equal)
+		if !ok {
+			conflicts = append(conflicts, entry.key)
+		}
+		if merged != nil {
+			lines = append(lines, merged.line)
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n"), conflicts
+}
+
+// mergeStructured merges the yaml or json documents key by key. Mappings
+// changed on both sides are merged recursively, any other value changed
+// differently on both sides is a conflict.
+func mergeStructured(base []byte, current []byte, other []byte, fileType string) ([]byte, []string, error) {
+	var documents [3]*yaml.Node
+	for index, content := range [][]byte{base, current, other} {
+		var document yaml.Node
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, nil, fmt.Errorf("unable to parse %s: %v", fileType, err)
+		}
+		if len(document.Content) > 0 {
+			documents[index] = document.Content[0]
+		}
+	}
+
+	var conflicts []string
+	merged := mergeYamlNode("", documents[0], documents[1], documents[2], &conflicts)
+	if len(conflicts) > 0 {
+		return nil, conflicts, nil
+	}
+	if merged == nil {
+		return nil, nil, nil
+	}
+
+	if fileType == "json" {
+		var buffer bytes.Buffer
+		if err := writeJsonNode(&buffer, merged); err != nil {
+			return nil, nil, err
+		}
+
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, buffer.Bytes(), "", "\t"); err != nil {
+			return nil, nil, fmt.Errorf("unable to write json: %v", err)
+		}
+		indented.WriteByte('\n')
+		return indented.Bytes(), nil, nil
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(merged); err != nil {
+		return nil, nil, fmt.Errorf("unable to write yaml: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, nil, fmt.Errorf("unable to write yaml: %v", err)
+	}
+	return buffer.Bytes(), nil, nil
+}
+
+// yamlNodeEqual compares the values of the nodes, ignoring comments and style
+func yamlNodeEqual(a *yaml.Node, b *yaml.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	var aValue, bValue any
+	if a.Decode(&aValue) != nil || b.Decode(&bValue) != nil {
+		return false
+	}
+	return reflect.DeepEqual(aValue, bValue)
+}
+
+func mergeYamlNode(path string, base *yaml.Node, current *yaml.Node, other *yaml.Node, conflicts *[]string) *yaml.Node {
+	merged, ok := mergeValue(base, current, other, yamlNodeEqual)
+	if ok {
+		return merged
+	}
+
+	var isMapping = func(node *yaml.Node) bool {
+		return node != nil && node.Kind == yaml.MappingNode
+	}
+	if !isMapping(current) || !isMapping(other) || (base != nil && !isMapping(base)) {
+		*conflicts = append(*conflicts, path)
+		return current
+	}
+
+	var result *yaml.Node = &yaml.Node{Kind: yaml.MappingNode, Tag: current.Tag, Style: current.Style,
+		HeadComment: current.HeadComment, LineComment: current.LineComment, FootComment: current.FootComment}
+
+	var keys []*yaml.Node
+	for index := 0; index+1 < len(current.Content); index += 2 {
+		keys = append(keys, current.Content[index])
+	}
+	for index := 0; index+1 < len(other.Content); index += 2 {
+		if yamlMappingLookup(current, other.Content[index].Value) == nil {
+			keys = append(keys, other.Content[index])
+		}
+	}
+
+	for _, key := range keys {
+		var childPath string = key.Value
+		if path != "" {
+			childPath = path + "." + key.Value
+		}
+
+		child := mergeYamlNode(childPath, yamlMappingLookup(base, key.Value),
+			yamlMappingLookup(current, key.Value), yamlMappingLookup(other, key.Value), conflicts)
+		if child != nil {
+			result.Content = append(result.Content, key, child)
+		}
+	}
+
+	return result
+}
+
+func yamlMappingLookup(node *yaml.Node, key string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		if node.Content[index].Value == key {
+			return node.Content[index+1]
+		}
+	}
+	return nil
+}
+
+// writeJsonNode writes the yaml node parsed from a json document back as
+// json, keeping the order of the keys
+func writeJsonNode(buffer *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		buffer.WriteByte('{')
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			if index > 0 {
+				buffer.WriteByte(',')
+			}
+			key, _ := json.Marshal(node.Content[index].Value)
+			buffer.Write(key)
+			buffer.WriteByte(':')
+			if err := writeJsonNode(buffer, node.Content[index+1]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('}')
+	case yaml.SequenceNode:
+		buffer.WriteByte('[')
+		for index, child := range node.Content {
+			if index > 0 {
+				buffer.WriteByte(',')
+			}
+			if err := writeJsonNode(buffer, child); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(']')
+	case yaml.ScalarNode:
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return fmt.Errorf("unable to write json: %v", err)
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("unable to write json: %v", err)
+		}
+		buffer.Write(encoded)
+	case yaml.AliasNode:
+		return writeJsonNode(buffer, node.Alias)
+	default:
+		return fmt.Errorf("unable to write json: unexpected yaml node")
+	}
+	return nil
+}
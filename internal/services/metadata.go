@@ -0,0 +1,261 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The separator sops uses to flatten nested metadata into the
+// key=value formats (dotenv and ini)
+const (
+	sopsListSeparator = "__list_"
+	sopsMapSeparator  = "__map_"
+)
+
+// SopsMetadata is the parsed "sops" metadata block of an encrypted
+// file. Only the fields that composectl uses are extracted.
+type SopsMetadata struct {
+	AgeRecipients   []string
+	PgpFingerprints []string
+	KmsArns         []string
+	LastModified    time.Time
+	Mac             string
+	Version         string
+	// The partial encryption settings the file was encrypted with
+	EncryptedRegex    string
+	UnencryptedSuffix string
+
+	// The URIs of the HashiCorp Vault transit keys, e.g.
+	// http://127.0.0.1:8200/v1/transit/keys/sops
+	HcVaultTransitUris []string
+	// The resource IDs of the GCP KMS keys
+	GcpKmsResourceIds []string
+	// The URLs of the Azure Key Vault keys, e.g.
+	// https://vault.vault.azure.net/keys/sops/0123456789abcdef
+	AzureKeyVaultUrls []string
+}
+
+// MasterKeys returns the age recipients followed by the master keys of the
+// other types: the PGP fingerprints, the AWS KMS ARNs, the Vault transit
+// URIs, the GCP KMS resource IDs and the Azure Key Vault key URLs
+func (m SopsMetadata) MasterKeys() []string {
+	var keys []string = slices.Clone(m.AgeRecipients)
+	for _, other := range [][]string{m.PgpFingerprints, m.KmsArns, m.HcVaultTransitUris, m.GcpKmsResourceIds, m.AzureKeyVaultUrls} {
+		keys = append(keys, other...)
+	}
+	return keys
+}
+
+// ReadSopsMetadata parses the sops metadata block of the encrypted file
+// without decrypting it, so that it works even if the private key
+// isn't available on this machine.
+func ReadSopsMetadata(encryptedFilePath string) (SopsMetadata, error) {
+	content, err := os.ReadFile(encryptedFilePath)
+	if err != nil {
+		return SopsMetadata{}, fmt.Errorf("unable to read %s: %v", encryptedFilePath, err)
+	}
+
+	fileType, _ := parseEncFilename(encryptedFilePath, filepath.Base(encryptedFilePath))
+
+	flat, err := readFlatSopsMetadata(content, fileType)
+	if err != nil {
+		return SopsMetadata{}, fmt.Errorf("unable to parse the sops metadata of %s: %v", encryptedFilePath, err)
+	}
+
+	if len(flat) == 0 {
+		return SopsMetadata{}, fmt.Errorf("no sops metadata found in %s", encryptedFilePath)
+	}
+
+	return metadataFromFlat(flat), nil
+}
+
+// readFlatSopsMetadata returns the sops metadata as a flat map using the
+// same key format as sops uses for dotenv, e.g. "age__list_0__map_recipient"
+func readFlatSopsMetadata(content []byte, fileType string) (map[string]string, error) {
+	var flat map[string]string = make(map[string]string)
+
+	switch fileType {
+	case "dotenv":
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "sops_") {
+				continue
+			}
+
+			key, value, found := strings.Cut(strings.TrimPrefix(line, "sops_"), "=")
+			if found {
+				flat[key] = value
+			}
+		}
+		return flat, scanner.Err()
+	case "ini":
+		var inSopsSection bool = false
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+				inSopsSection = line == "[sops]"
+				continue
+			}
+			if !inSopsSection || line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			key, value, found := strings.Cut(line, "=")
+			if found {
+				flat[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+		return flat, scanner.Err()
+	default:
+		// yaml, json and binary (stored as json by sops). A json
+		// document is valid yaml, so a single parser handles all of them
+		var document struct {
+			Sops map[string]any `yaml:"sops"`
+		}
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, err
+		}
+
+		flattenSopsMetadata("", document.Sops, flat)
+		return flat, nil
+	}
+}
+
+// flattenSopsMetadata flattens a nested sops metadata block into the
+// key format used by sops for the dotenv and ini stores
+func flattenSopsMetadata(prefix string, value any, flat map[string]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			var childKey string = key
+			if prefix != "" {
+				childKey = prefix + sopsMapSeparator + key
+			}
+			flattenSopsMetadata(childKey, child, flat)
+		}
+	case []any:
+		for index, child := range v {
+			flattenSopsMetadata(prefix+sopsListSeparator+strconv.Itoa(index), child, flat)
+		}
+	case nil:
+		flat[prefix] = ""
+	case time.Time:
+		flat[prefix] = v.Format(time.RFC3339)
+	default:
+		flat[prefix] = fmt.Sprint(v)
+	}
+}
+
+func metadataFromFlat(flat map[string]string) SopsMetadata {
+	var metadata SopsMetadata = SopsMetadata{
+		AgeRecipients:   normalizeAgeRecipients(flatMetadataKeys(flat, "age", "recipient")),
+		PgpFingerprints: flatMetadataKeys(flat, "pgp", "fp"),
+		KmsArns:         flatMetadataKeys(flat, "kms", "arn"),
+		Mac:             flat["mac"],
+		Version:         flat["version"],
+
+		EncryptedRegex:    flat["encrypted_regex"],
+		UnencryptedSuffix: flat["unencrypted_suffix"],
+	}
+
+	metadata.HcVaultTransitUris = vaultTransitUris(flatMetadataKeys(flat, "hc_vault", "vault_address"),
+		flatMetadataKeys(flat, "hc_vault", "engine_path"), flatMetadataKeys(flat, "hc_vault", "key_name"))
+	metadata.GcpKmsResourceIds = flatMetadataKeys(flat, "gcp_kms", "resource_id")
+	metadata.AzureKeyVaultUrls = azureKeyVaultUrls(flatMetadataKeys(flat, "azure_kv", "vault_url"),
+		flatMetadataKeys(flat, "azure_kv", "name"), flatMetadataKeys(flat, "azure_kv", "version"))
+
+	if lastModified, err := time.Parse(time.RFC3339, flat["lastmodified"]); err == nil {
+		metadata.LastModified = lastModified
+	}
+
+	return metadata
+}
+
+// flatMetadataKeys returns the given field of every master key of the
+// given type, including the keys nested in the "key_groups" of sops
+func flatMetadataKeys(flat map[string]string, keyType string, field string) []string {
+	var values []string = flatMetadataList(flat, keyType, field)
+	for group := 0; ; group++ {
+		var groupPrefix string = "key_groups" + sopsListSeparator + strconv.Itoa(group) + sopsMapSeparator
+		if !hasFlatPrefix(flat, groupPrefix) {
+			return values
+		}
+		values = append(values, flatMetadataList(flat, groupPrefix+keyType, field)...)
+	}
+}
+
+func hasFlatPrefix(flat map[string]string, prefix string) bool {
+	for key := range flat {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// flatMetadataList returns the given field of every entry of a flattened
+// metadata list, e.g. "age__list_0__map_recipient", "age__list_1__map_recipient"
+func flatMetadataList(flat map[string]string, list string, field string) []string {
+	var values []string
+	for index := 0; ; index++ {
+		value, ok := flat[list+sopsListSeparator+strconv.Itoa(index)+sopsMapSeparator+field]
+		if !ok {
+			return values
+		}
+		values = append(values, value)
+	}
+}
+
+// vaultTransitUris joins the fields of the hc_vault metadata entries
+// back into the URIs given to sops with --hc-vault-transit
+func vaultTransitUris(addresses []string, enginePaths []string, keyNames []string) []string {
+	var uris []string
+	for index := 0; index < len(addresses) && index < len(enginePaths) && index < len(keyNames); index++ {
+		uris = append(uris, strings.TrimSuffix(addresses[index], "/")+"/v1/"+enginePaths[index]+"/keys/"+keyNames[index])
+	}
+	return uris
+}
+
+// azureKeyVaultUrls joins the fields of the azure_kv metadata entries
+// back into the key URLs given to sops with --azure-kv
+func azureKeyVaultUrls(vaultUrls []string, names []string, versions []string) []string {
+	var urls []string
+	for index := 0; index < len(vaultUrls) && index < len(names) && index < len(versions); index++ {
+		urls = append(urls, strings.TrimSuffix(vaultUrls[index], "/")+"/keys/"+names[index]+"/"+versions[index])
+	}
+	return urls
+}
+
+func normalizeAgeRecipients(recipients []string) []string {
+	for index, recipient := range recipients {
+		recipients[index] = NormalizeAgeRecipient(recipient)
+	}
+	return recipients
+}
@@ -0,0 +1,180 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVaultTransitUris(t *testing.T) {
+	var tests = []struct {
+		name        string
+		addresses   []string
+		enginePaths []string
+		keyNames    []string
+		want        []string
+	}{
+		{"none", nil, nil, nil, nil},
+		{"single", []string{"http://127.0.0.1:8200"}, []string{"transit"}, []string{"sops"},
+			[]string{"http://127.0.0.1:8200/v1/transit/keys/sops"}},
+		{"trailing slash of the address", []string{"https://vault.example.com/"}, []string{"sops/transit"},
+			[]string{"prod"}, []string{"https://vault.example.com/v1/sops/transit/keys/prod"}},
+		{"several", []string{"http://a:8200", "http://b:8200"}, []string{"transit", "transit"}, []string{"one", "two"},
+			[]string{"http://a:8200/v1/transit/keys/one", "http://b:8200/v1/transit/keys/two"}},
+		{"incomplete entry is skipped", []string{"http://a:8200", "http://b:8200"}, []string{"transit", "transit"},
+			[]string{"one"}, []string{"http://a:8200/v1/transit/keys/one"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := vaultTransitUris(test.addresses, test.enginePaths, test.keyNames); !slices.Equal(got, test.want) {
+				t.Errorf("vaultTransitUris() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMetadataFromFlat(t *testing.T) {
+	var lastModified time.Time = time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	var tests = []struct {
+		name string
+		flat map[string]string
+		want SopsMetadata
+	}{
+		{"empty", map[string]string{}, SopsMetadata{}},
+		{"dotenv metadata", map[string]string{
+			"age__list_0__map_recipient":          "age1first",
+			"age__list_0__map_enc":                "-----BEGIN AGE ENCRYPTED FILE-----",
+			"age__list_1__map_recipient":          "ssh-ed25519 AAAAC3Nza comment@host",
+			"hc_vault__list_0__map_vault_address": "http://127.0.0.1:8200",
+			"hc_vault__list_0__map_engine_path":   "transit",
+			"hc_vault__list_0__map_key_name":      "sops",
+			"lastmodified":                        "2025-03-04T05:06:07Z",
+			"mac":                                 "ENC[AES256_GCM,data:abc]",
+			"version":                             "3.9.0",
+			"encrypted_regex":                     "^(password|token)$",
+		}, SopsMetadata{
+			AgeRecipients:      []string{"age1first", "ssh-ed25519 AAAAC3Nza"},
+			HcVaultTransitUris: []string{"http://127.0.0.1:8200/v1/transit/keys/sops"},
+			LastModified:       lastModified,
+			Mac:                "ENC[AES256_GCM,data:abc]",
+			Version:            "3.9.0",
+			EncryptedRegex:     "^(password|token)$",
+		}},
+		{"key groups", map[string]string{
+			"key_groups__list_0__map_age__list_0__map_recipient":       "age1group",
+			"key_groups__list_0__map_pgp__list_0__map_fp":              "FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4",
+			"key_groups__list_1__map_kms__list_0__map_arn":             "arn:aws:kms:us-east-1:123:key/abc",
+			"key_groups__list_1__map_gcp_kms__list_0__map_resource_id": "projects/p/locations/global/keyRings/r/cryptoKeys/k",
+		}, SopsMetadata{
+			AgeRecipients:     []string{"age1group"},
+			PgpFingerprints:   []string{"FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4"},
+			KmsArns:           []string{"arn:aws:kms:us-east-1:123:key/abc"},
+			GcpKmsResourceIds: []string{"projects/p/locations/global/keyRings/r/cryptoKeys/k"},
+		}},
+		{"azure key vault", map[string]string{
+			"azure_kv__list_0__map_vault_url": "https://vault.vault.azure.net/",
+			"azure_kv__list_0__map_name":      "sops",
+			"azure_kv__list_0__map_version":   "0123",
+		}, SopsMetadata{
+			AzureKeyVaultUrls: []string{"https://vault.vault.azure.net/keys/sops/0123"},
+		}},
+		{"invalid lastmodified", map[string]string{"lastmodified": "yesterday"}, SopsMetadata{}},
+		{"list with a gap stops at the gap", map[string]string{
+			"age__list_0__map_recipient": "age1first",
+			"age__list_2__map_recipient": "age1third",
+		}, SopsMetadata{AgeRecipients: []string{"age1first"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertSopsMetadata(t, metadataFromFlat(test.flat), test.want)
+		})
+	}
+}
+
+func TestFlattenSopsMetadata(t *testing.T) {
+	var lastModified time.Time = time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	var metadata map[string]any = map[string]any{
+		"age": []any{
+			map[string]any{"recipient": "age1first", "enc": "..."},
+		},
+		"key_groups": []any{
+			map[string]any{"pgp": []any{map[string]any{"fp": "FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4"}}},
+		},
+		"hc_vault": []any{
+			map[string]any{"vault_address": "http://127.0.0.1:8200", "engine_path": "transit", "key_name": "sops"},
+		},
+		"lastmodified":       lastModified,
+		"unencrypted_suffix": "_unencrypted",
+		"kms":                nil,
+	}
+
+	var flat map[string]string = make(map[string]string)
+	flattenSopsMetadata("", metadata, flat)
+
+	if value, ok := flat["age__list_0__map_recipient"]; !ok || value != "age1first" {
+		t.Errorf("flattened age recipient = %q, want %q", value, "age1first")
+	}
+	if value, ok := flat["kms"]; !ok || value != "" {
+		t.Errorf("flattened null = %q, %v, want an empty value", value, ok)
+	}
+
+	assertSopsMetadata(t, metadataFromFlat(flat), SopsMetadata{
+		AgeRecipients:      []string{"age1first"},
+		PgpFingerprints:    []string{"FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4"},
+		HcVaultTransitUris: []string{"http://127.0.0.1:8200/v1/transit/keys/sops"},
+		LastModified:       lastModified,
+		UnencryptedSuffix:  "_unencrypted",
+	})
+}
+
+// assertSopsMetadata compares the fields of the metadata
+func assertSopsMetadata(t *testing.T, got SopsMetadata, want SopsMetadata) {
+	t.Helper()
+
+	var lists = []struct {
+		field     string
+		got, want []string
+	}{
+		{"AgeRecipients", got.AgeRecipients, want.AgeRecipients},
+		{"PgpFingerprints", got.PgpFingerprints, want.PgpFingerprints},
+		{"KmsArns", got.KmsArns, want.KmsArns},
+		{"HcVaultTransitUris", got.HcVaultTransitUris, want.HcVaultTransitUris},
+		{"GcpKmsResourceIds", got.GcpKmsResourceIds, want.GcpKmsResourceIds},
+		{"AzureKeyVaultUrls", got.AzureKeyVaultUrls, want.AzureKeyVaultUrls},
+	}
+	for _, list := range lists {
+		if !slices.Equal(list.got, list.want) {
+			t.Errorf("%s = %q, want %q", list.field, list.got, list.want)
+		}
+	}
+
+	if !got.LastModified.Equal(want.LastModified) {
+		t.Errorf("LastModified = %v, want %v", got.LastModified, want.LastModified)
+	}
+	if got.Mac != want.Mac || got.Version != want.Version {
+		t.Errorf("Mac, Version = %q, %q, want %q, %q", got.Mac, got.Version, want.Mac, want.Version)
+	}
+	if got.EncryptedRegex != want.EncryptedRegex || got.UnencryptedSuffix != want.UnencryptedSuffix {
+		t.Errorf("EncryptedRegex, UnencryptedSuffix = %q, %q, want %q, %q", got.EncryptedRegex,
+			got.UnencryptedSuffix, want.EncryptedRegex, want.UnencryptedSuffix)
+	}
+}
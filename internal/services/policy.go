@@ -0,0 +1,302 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// SecretsPolicy is the committed secrets policy of the repository, e.g.
+//
+//	max_age_days: 180
+//	services:
+//	  - match: payment-*
+//	    max_age_days: 90
+//	    recipients:
+//	      - alice
+//	      - age1...
+type SecretsPolicy struct {
+	Path string `yaml:"-"`
+	// The maximum age of a secret in days, 0 uses the default
+	MaxAgeDays int             `yaml:"max_age_days"`
+	Services   []ServicePolicy `yaml:"services"`
+}
+
+// ServicePolicy overrides the policy for the matching services
+type ServicePolicy struct {
+	// A service name or a glob over the service names
+	Match string `yaml:"match"`
+	// The maximum age of a secret in days, 0 uses the repository policy
+	MaxAgeDays int `yaml:"max_age_days"`
+	// The age or SSH public keys, the names of the members of the team
+	// manifest, or the other master keys (PGP fingerprints, AWS KMS ARNs,
+	// Vault transit URIs, GCP KMS resource IDs and Azure Key Vault key
+	// URLs) that the secrets must be encrypted to. Any recipient is
+	// allowed when unset.
+	Recipients []string `yaml:"recipients"`
+}
+
+// LoadSecretsPolicy loads the secrets policy of the repository. It returns
+// nil without an error when the repository doesn't have one.
+func LoadSecretsPolicy(repoRoot string) (*SecretsPolicy, error) {
+	var policyPath string = filepath.Join(repoRoot, config.SecretsPolicyFile)
+
+	content, err := os.ReadFile(policyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", policyPath, err)
+	}
+
+	var policy SecretsPolicy
+	if err := yaml.Unmarshal(content, &policy); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", policyPath, err)
+	}
+	policy.Path = policyPath
+
+	for _, service := range policy.Services {
+		if _, err := path.Match(service.Match, ""); err != nil || service.Match == "" {
+			return nil, fmt.Errorf("invalid service match %q in %s", service.Match, policyPath)
+		}
+		if service.Recipients != nil && len(service.Recipients) == 0 {
+			return nil, fmt.Errorf("the recipients of %q in %s are empty", service.Match, policyPath)
+		}
+	}
+
+	return &policy, nil
+}
+
+// ServicePolicyFor returns the first service policy matching the service,
+// or nil when none matches
+func (p *SecretsPolicy) ServicePolicyFor(name string) *ServicePolicy {
+	if p == nil {
+		return nil
+	}
+
+	for index := range p.Services {
+		if matched, _ := path.Match(p.Services[index].Match, name); matched {
+			return &p.Services[index]
+		}
+	}
+	return nil
+}
+
+// MaxAgeDaysFor returns the maximum age of the secrets of the service in
+// days: the matching service policy, then the repository policy, then
+// the given default
+func (p *SecretsPolicy) MaxAgeDaysFor(name string, defaultDays int) int {
+	if service := p.ServicePolicyFor(name); service != nil && service.MaxAgeDays > 0 {
+		return service.MaxAgeDays
+	}
+	if p != nil && p.MaxAgeDays > 0 {
+		return p.MaxAgeDays
+	}
+	return defaultDays
+}
+
+// HasRecipientsPolicy reports whether any service policy restricts the
+// recipients of the secrets
+func (p *SecretsPolicy) HasRecipientsPolicy() bool {
+	if p == nil {
+		return false
+	}
+
+	for _, service := range p.Services {
+		if service.Recipients != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedRecipientsFor returns the public keys that the secrets of the
+// service must be encrypted to, from the first service policy matching the
+// service that sets recipients. The names of team members are resolved to
+// their public keys. It reports false when no policy restricts the
+// recipients of the service.
+func (p *SecretsPolicy) AllowedRecipientsFor(name string, team *TeamManifest) ([]string, bool, error) {
+	if p == nil {
+		return nil, false, nil
+	}
+
+	for _, service := range p.Services {
+		if matched, _ := path.Match(service.Match, name); !matched || service.Recipients == nil {
+			continue
+		}
+
+		var allowed []string
+		for _, recipient := range service.Recipients {
+			var publicKey string = NormalizeAgeRecipient(recipient)
+			if member := team.Member(recipient); member != nil {
+				publicKey = member.PublicKey
+			} else if isMasterKey(recipient) {
+				publicKey = recipient
+			} else if err := ValidateAgeRecipient(publicKey); err != nil {
+				return nil, true, fmt.Errorf("the recipient %q of %q in %s is neither a public key nor a team member",
+					recipient, service.Match, p.Path)
+			}
+
+			if !slices.Contains(allowed, publicKey) {
+				allowed = append(allowed, publicKey)
+			}
+		}
+		return allowed, true, nil
+	}
+	return nil, false, nil
+}
+
+// The PGP fingerprints are 16 or 40 hexadecimal characters
+var pgpFingerprintRegex = regexp.MustCompile(`^([0-9A-Fa-f]{16}|[0-9A-Fa-f]{40})$`)
+
+// isMasterKey reports whether the recipient is a master key of a type
+// other than age, in the format of SopsMetadata.MasterKeys
+func isMasterKey(recipient string) bool {
+	return strings.HasPrefix(recipient, "arn:aws:kms:") || strings.HasPrefix(recipient, "projects/") ||
+		strings.HasPrefix(recipient, "https://") || strings.HasPrefix(recipient, "http://") ||
+		pgpFingerprintRegex.MatchString(recipient)
+}
+
+// CheckRecipients returns an error when the master keys differ from the
+// recipients allowed by the policy for the service. Every type of master
+// key is compared, so a key that isn't listed in the policy is rejected.
+func (p *SecretsPolicy) CheckRecipients(name string, team *TeamManifest, recipients []string) error {
+	allowed, found, err := p.AllowedRecipientsFor(name, team)
+	if err != nil || !found {
+		return err
+	}
+
+	missing, extra := CompareRecipients(allowed, recipients)
+	if len(extra) > 0 {
+		return fmt.Errorf("the policy in %s doesn't allow %s to decrypt the secrets of %s",
+			p.Path, strings.Join(extra, ", "), name)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the policy in %s requires the secrets of %s to be encrypted to %s as well",
+			p.Path, name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// RecipientsPolicyResult is the result of checking the recipients of a
+// secret against the policy
+type RecipientsPolicyResult struct {
+	Service string
+	File    ServiceFile
+	// The recipients allowed by the policy
+	Allowed []string
+	// Allowed recipients that the secret is not encrypted to
+	Missing []string
+	// Recipients of the secret that are not allowed
+	Extra []string
+}
+
+// CheckRekeyPolicy returns an error when a planned rekey would leave a secret
+// encrypted to other keys than the recipients allowed by the policy. The
+// team is the manifest as it will be once the plans are applied.
+func CheckRekeyPolicy(repoRoot string, plans []RekeyPlan, team *TeamManifest) error {
+	policy, err := LoadSecretsPolicy(repoRoot)
+	if err != nil || !policy.HasRecipientsPolicy() {
+		return err
+	}
+
+	for _, plan := range plans {
+		metadata, err := ReadSopsMetadata(filepath.Join(repoRoot, config.DockerServicesDir, plan.Service, plan.File.Filename))
+		if err != nil {
+			return err
+		}
+
+		// The rekey changes the age recipients and the Vault transit keys only
+		metadata.AgeRecipients = plan.Recipients
+		metadata.HcVaultTransitUris = slices.DeleteFunc(slices.Clone(metadata.HcVaultTransitUris), func(uri string) bool {
+			return slices.Contains(plan.RemoveHcVaultTransitUris, uri)
+		})
+		metadata.HcVaultTransitUris = append(metadata.HcVaultTransitUris, plan.AddHcVaultTransitUris...)
+
+		if err := policy.CheckRecipients(plan.Service, team, metadata.MasterKeys()); err != nil {
+			return fmt.Errorf("%s/%s: %v", plan.Service, plan.File.Filename, err)
+		}
+	}
+	return nil
+}
+
+// CheckRecipientsPolicy compares the master keys of every encrypted file
+// of the given services with the recipients allowed by the policy. The
+// services without a recipients policy are skipped.
+func CheckRecipientsPolicy(repoRoot string, serviceNames []string, policy *SecretsPolicy) ([]RecipientsPolicyResult, error) {
+	team, err := LoadTeamManifest(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RecipientsPolicyResult
+	for _, name := range serviceNames {
+		allowed, found, err := policy.AllowedRecipientsFor(name, team)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+
+		files, err := ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving service's details: %v", err)
+		}
+
+		for _, file := range files {
+			var encryptedFilePath string = filepath.Join(repoRoot, config.DockerServicesDir, name, file.Filename)
+
+			metadata, err := ReadSopsMetadata(encryptedFilePath)
+			if err != nil {
+				return nil, err
+			}
+
+			var result RecipientsPolicyResult = RecipientsPolicyResult{Service: name, File: file, Allowed: allowed}
+			result.Missing, result.Extra = CompareRecipients(allowed, metadata.MasterKeys())
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// CompareRecipients returns the expected recipients missing from the
+// actual recipients, and the actual recipients that are not expected
+func CompareRecipients(expected []string, actual []string) ([]string, []string) {
+	var missing, extra []string
+	for _, recipient := range expected {
+		if !slices.Contains(actual, recipient) {
+			missing = append(missing, recipient)
+		}
+	}
+	for _, recipient := range actual {
+		if !slices.Contains(expected, recipient) {
+			extra = append(extra, recipient)
+		}
+	}
+	return missing, extra
+}
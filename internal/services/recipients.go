@@ -0,0 +1,100 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+// SecretRecipients is the audit result of who can decrypt a secret
+type SecretRecipients struct {
+	Service  string
+	File     ServiceFile
+	Metadata SopsMetadata
+	// The configured age recipients, empty when nothing is configured
+	Expected []string
+	// Expected recipients that the secret is not encrypted to
+	Missing []string
+	// Age recipients of the secret that are not expected
+	Extra []string
+	// Whether one of the identities in keys.txt is a recipient
+	CanDecrypt bool
+	// The error reading the sops metadata, the other fields are empty when set
+	Err error
+}
+
+// GetSecretRecipients reads the sops metadata of every encrypted file of
+// the given services and compares the age recipients with the configured
+// recipients (the matching .sops.yaml creation rule, or the defaultRecipients,
+// plus the team members that can access the service) and with the public
+// keys of the identities held by the current user.
+func GetSecretRecipients(repoRoot string, serviceNames []string, defaultRecipients []string,
+	identities []string) ([]SecretRecipients, error) {
+	sopsConfig, err := LoadSopsConfig(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	team, err := LoadTeamManifest(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SecretRecipients
+	for _, name := range serviceNames {
+		files, err := ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving service's details: %v", err)
+		}
+
+		for _, file := range files {
+			var encryptedFilePath string = filepath.Join(repoRoot, config.DockerServicesDir, name, file.Filename)
+
+			metadata, err := ReadSopsMetadata(encryptedFilePath)
+			if err != nil {
+				// Keep auditing the other secrets
+				results = append(results, SecretRecipients{Service: name, File: file, Err: err})
+				continue
+			}
+
+			expected, err := resolveExpectedRecipients(sopsConfig, encryptedFilePath, nil, defaultRecipients,
+				team.RecipientsFor(name))
+			if err != nil {
+				return nil, err
+			}
+
+			var result SecretRecipients = SecretRecipients{Service: name, File: file, Metadata: metadata, Expected: expected}
+			if len(expected) > 0 {
+				result.Missing, result.Extra = CompareRecipients(expected, metadata.AgeRecipients)
+			}
+
+			for _, identity := range identities {
+				if slices.Contains(metadata.AgeRecipients, identity) {
+					result.CanDecrypt = true
+					break
+				}
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
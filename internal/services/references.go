@@ -0,0 +1,309 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+type ReferenceKind string
+
+const (
+	RefEnvFile ReferenceKind = "env_file"
+	RefSecret  ReferenceKind = "secret"
+	RefConfig  ReferenceKind = "config"
+	RefBind    ReferenceKind = "bind"
+)
+
+// ComposeReference is a file of the service referenced by a compose file
+type ComposeReference struct {
+	// The compose file, relative to the service directory
+	ComposeFile string
+	Kind        ReferenceKind
+	// The compose service, or the secret or config name for the
+	// top-level secrets and configs
+	Name string
+	// The referenced path, relative to the service directory
+	Path string
+	// An env_file with "required: false" may be missing
+	Required bool
+}
+
+type ReferenceState int
+
+const (
+	ReferenceOK ReferenceState = iota
+	// The plaintext file is missing but its encrypted source exists
+	ReferenceNotDecrypted
+	// Neither the plaintext file nor an encrypted source exists
+	ReferenceMissing
+	// The plaintext file exists, but it is git ignored and has no
+	// encrypted source, so nobody else has it
+	ReferenceNotEncrypted
+)
+
+type ReferenceResult struct {
+	Reference ComposeReference
+	State     ReferenceState
+}
+
+// ReferenceReport is the result of CheckServiceReferences
+type ReferenceReport struct {
+	References []ReferenceResult
+	// The encrypted files, relative to the service directory, whose
+	// decrypted counterpart isn't referenced by any compose file
+	Orphaned []string
+}
+
+// HasIssues reports whether any reference is broken or any encrypted
+// file is orphaned
+func (r *ReferenceReport) HasIssues() bool {
+	for _, result := range r.References {
+		if result.State != ReferenceOK {
+			return true
+		}
+	}
+	return len(r.Orphaned) > 0
+}
+
+func GetReferenceStateString(state ReferenceState) string {
+	switch state {
+	case ReferenceOK:
+		return "OK"
+	case ReferenceNotDecrypted:
+		return "Not decrypted"
+	case ReferenceMissing:
+		return "Missing"
+	case ReferenceNotEncrypted:
+		return "Not encrypted"
+	default:
+		return "Unknown"
+	}
+}
+
+// composeDocument is the part of a compose file that references files
+type composeDocument struct {
+	Services map[string]struct {
+		EnvFile any   `yaml:"env_file"`
+		Volumes []any `yaml:"volumes"`
+	} `yaml:"services"`
+	Secrets map[string]struct {
+		File string `yaml:"file"`
+	} `yaml:"secrets"`
+	Configs map[string]struct {
+		File string `yaml:"file"`
+	} `yaml:"configs"`
+}
+
+// ParseComposeReferences returns the env_file, the top-level secrets and
+// configs file sources and the bind mount sources of the compose file that
+// are inside the service directory. The paths containing a variable are
+// skipped as they can't be resolved.
+func ParseComposeReferences(servicePath string, composeFile string) ([]ComposeReference, error) {
+	content, err := os.ReadFile(filepath.Join(servicePath, composeFile))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", composeFile, err)
+	}
+
+	var document composeDocument
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", composeFile, err)
+	}
+
+	var references []ComposeReference
+	var addReference = func(kind ReferenceKind, name string, path string, required bool) {
+		if path == "" || strings.Contains(path, "$") || strings.HasPrefix(path, "~") {
+			return
+		}
+
+		// Relative paths are resolved from the directory of the compose file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(composeFile), path)
+		} else if relativePath, err := filepath.Rel(servicePath, path); err == nil {
+			path = relativePath
+		}
+		path = filepath.Clean(path)
+		if path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) || filepath.IsAbs(path) {
+			return
+		}
+
+		references = append(references, ComposeReference{ComposeFile: composeFile, Kind: kind,
+			Name: name, Path: filepath.ToSlash(path), Required: required})
+	}
+
+	for serviceName, service := range document.Services {
+		switch envFile := service.EnvFile.(type) {
+		case string:
+			addReference(RefEnvFile, serviceName, envFile, true)
+		case []any:
+			for _, entry := range envFile {
+				switch value := entry.(type) {
+				case string:
+					addReference(RefEnvFile, serviceName, value, true)
+				case map[string]any:
+					path, _ := value["path"].(string)
+					required, ok := value["required"].(bool)
+					addReference(RefEnvFile, serviceName, path, required || !ok)
+				}
+			}
+		}
+
+		for _, volume := range service.Volumes {
+			switch value := volume.(type) {
+			case string:
+				// The short syntax is SOURCE:TARGET[:MODE], a source that
+				// isn't a path is a named volume
+				source, _, found := strings.Cut(value, ":")
+				if found && (strings.HasPrefix(source, ".") || strings.HasPrefix(source, "/")) {
+					addReference(RefBind, serviceName, source, true)
+				}
+			case map[string]any:
+				if volumeType, _ := value["type"].(string); volumeType == "bind" {
+					source, _ := value["source"].(string)
+					addReference(RefBind, serviceName, source, true)
+				}
+			}
+		}
+	}
+
+	for name, secret := range document.Secrets {
+		addReference(RefSecret, name, secret.File, true)
+	}
+	for name, config := range document.Configs {
+		addReference(RefConfig, name, config.File, true)
+	}
+
+	sort.SliceStable(references, func(i, j int) bool {
+		if references[i].Path != references[j].Path {
+			return references[i].Path < references[j].Path
+		}
+		return references[i].Name < references[j].Name
+	})
+
+	return references, nil
+}
+
+// CheckServiceReferences cross-references the files referenced by every
+// compose file of the service with its encrypted secrets. It reports the
+// referenced files that are not decrypted, missing or not encrypted, and
+// the encrypted files that no compose file references.
+//
+// The .env next to a compose file is always considered referenced, as
+// compose reads it for the variable interpolation, and so is every
+// file under a bind-mounted directory.
+func CheckServiceReferences(repoRoot string, name string) (*ReferenceReport, error) {
+	var servicePath string = filepath.Join(repoRoot, config.DockerServicesDir, name)
+
+	composeFiles, err := FindComposeFiles(servicePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the compose files of %s: %v", name, err)
+	}
+
+	files, err := ResolveServiceFiles(repoRoot, name, true)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving service's details: %v", err)
+	}
+
+	// The encrypted source of every decrypted path, relative to the service
+	var encryptedSources map[string]string = make(map[string]string)
+	for _, file := range files {
+		relativePath, err := filepath.Rel(servicePath, DecryptedFilePath(repoRoot, name, file))
+		if err != nil {
+			return nil, err
+		}
+		encryptedSources[filepath.ToSlash(relativePath)] = file.Filename
+	}
+
+	var report *ReferenceReport = &ReferenceReport{}
+	var referenced map[string]bool = make(map[string]bool)
+	var boundDirectories []string
+
+	for _, composeFile := range composeFiles {
+		var implicitEnv string = filepath.ToSlash(filepath.Join(filepath.Dir(composeFile), ".env"))
+		referenced[implicitEnv] = true
+
+		references, err := ParseComposeReferences(servicePath, composeFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, reference := range references {
+			var plaintextPath string = filepath.Join(servicePath, filepath.FromSlash(reference.Path))
+			info, statErr := os.Stat(plaintextPath)
+			_, hasEncrypted := encryptedSources[reference.Path]
+
+			if reference.Kind == RefBind {
+				if statErr == nil && info.IsDir() {
+					boundDirectories = append(boundDirectories, reference.Path+"/")
+					continue
+				}
+				// Docker creates a missing bind source as a directory, so a
+				// missing source is only reported when it looks like a file
+				if statErr != nil && !hasEncrypted && filepath.Ext(reference.Path) == "" {
+					continue
+				}
+			}
+
+			referenced[reference.Path] = true
+			var result ReferenceResult = ReferenceResult{Reference: reference, State: ReferenceOK}
+
+			switch {
+			case statErr != nil && hasEncrypted:
+				result.State = ReferenceNotDecrypted
+			case statErr != nil && reference.Required:
+				result.State = ReferenceMissing
+			case statErr == nil && !hasEncrypted && !IsEncryptedFile(reference.Path):
+				ignored, err := isGitIgnored(repoRoot, filepath.Join(config.DockerServicesDir, name, reference.Path))
+				if err != nil {
+					return nil, err
+				}
+				if ignored {
+					result.State = ReferenceNotEncrypted
+				}
+			}
+
+			report.References = append(report.References, result)
+		}
+	}
+
+	for decryptedPath, encryptedPath := range encryptedSources {
+		if referenced[decryptedPath] {
+			continue
+		}
+
+		var inBoundDirectory bool = false
+		for _, directory := range boundDirectories {
+			if directory == "./" || strings.HasPrefix(decryptedPath, directory) {
+				inBoundDirectory = true
+				break
+			}
+		}
+		if !inBoundDirectory {
+			report.Orphaned = append(report.Orphaned, filepath.ToSlash(encryptedPath))
+		}
+	}
+	sort.Strings(report.Orphaned)
+
+	return report, nil
+}
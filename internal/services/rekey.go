@@ -0,0 +1,239 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+// RekeyPlan describes the recipient change of a single encrypted file
+type RekeyPlan struct {
+	Service          string
+	File             ServiceFile
+	Recipients       []string
+	AddRecipients    []string
+	RemoveRecipients []string
+	// The Vault transit keys to add and remove, the Vault transit keys
+	// of the file are left untouched when none are given to PlanRekey
+	AddHcVaultTransitUris    []string
+	RemoveHcVaultTransitUris []string
+}
+
+// PlanRekey resolves every encrypted file of the given services and
+// compares its current age recipients with the desired recipients.
+//
+// The desired recipients are the given recipients when not empty,
+// otherwise the recipients of the matching .sops.yaml creation rule,
+// falling back to the defaultRecipients, plus the public keys of the
+// team members that can access the service.
+//
+// When vaultUris is not empty, the Vault transit keys of the files are
+// changed to it as well. The age recipients are then left untouched
+// when there are no desired age recipients.
+func PlanRekey(repoRoot string, serviceNames []string, recipients []string, defaultRecipients []string,
+	vaultUris []string) ([]RekeyPlan, error) {
+	sopsConfig, err := LoadSopsConfig(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	team, err := LoadTeamManifest(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []RekeyPlan
+	for _, name := range serviceNames {
+		files, err := ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving service's details: %v", err)
+		}
+
+		for _, file := range files {
+			var encryptedFilePath string = filepath.Join(repoRoot, config.DockerServicesDir, name, file.Filename)
+
+			desired, err := resolveExpectedRecipients(sopsConfig, encryptedFilePath, recipients, defaultRecipients,
+				team.RecipientsFor(name))
+			if err != nil {
+				return nil, err
+			}
+			if len(desired) == 0 && len(vaultUris) == 0 {
+				return nil, fmt.Errorf("no recipients to rekey %s/%s to", name, file.Filename)
+			}
+
+			metadata, err := ReadSopsMetadata(encryptedFilePath)
+			if err != nil {
+				return nil, err
+			}
+
+			var plan RekeyPlan = RekeyPlan{Service: name, File: file, Recipients: desired}
+			if len(desired) > 0 {
+				plan.AddRecipients, plan.RemoveRecipients = diffRecipients(metadata.AgeRecipients, desired)
+			} else {
+				plan.Recipients = metadata.AgeRecipients
+			}
+			if len(vaultUris) > 0 {
+				plan.AddHcVaultTransitUris, plan.RemoveHcVaultTransitUris = diffRecipients(metadata.HcVaultTransitUris, vaultUris)
+			}
+
+			plans = append(plans, plan)
+		}
+	}
+
+	return plans, nil
+}
+
+// diffRecipients returns the desired recipients missing from the current
+// recipients, and the current recipients that are not desired
+func diffRecipients(current []string, desired []string) ([]string, []string) {
+	var add, remove []string
+	for _, recipient := range desired {
+		if !slices.Contains(current, recipient) {
+			add = append(add, recipient)
+		}
+	}
+	for _, recipient := range current {
+		if !slices.Contains(desired, recipient) {
+			remove = append(remove, recipient)
+		}
+	}
+	return add, remove
+}
+
+// resolveExpectedRecipients returns the age recipients that the encrypted
+// file should have: the given recipients when not empty, otherwise the
+// recipients of the matching .sops.yaml creation rule, falling back to
+// the defaultRecipients, plus the teamRecipients.
+func resolveExpectedRecipients(sopsConfig *SopsConfig, encryptedFilePath string,
+	recipients []string, defaultRecipients []string, teamRecipients []string) ([]string, error) {
+	if len(recipients) > 0 {
+		return recipients, nil
+	}
+
+	configured, err := resolveConfiguredRecipients(sopsConfig, encryptedFilePath, defaultRecipients)
+	if err != nil {
+		return nil, err
+	}
+
+	var expected []string = slices.Clone(configured)
+	for _, recipient := range teamRecipients {
+		if !slices.Contains(expected, recipient) {
+			expected = append(expected, recipient)
+		}
+	}
+	return expected, nil
+}
+
+// resolveConfiguredRecipients returns the recipients of the matching
+// .sops.yaml creation rule, falling back to the defaultRecipients.
+//
+// As sops matches the creation rule against the plaintext file when it
+// encrypts, the decrypted counterpart is also tried when the encrypted
+// file doesn't match any rule.
+func resolveConfiguredRecipients(sopsConfig *SopsConfig, encryptedFilePath string, defaultRecipients []string) ([]string, error) {
+	if sopsConfig != nil {
+		_, decryptedFilename := parseEncFilename(encryptedFilePath, filepath.Base(encryptedFilePath))
+		var decryptedFilePath string = filepath.Join(filepath.Dir(encryptedFilePath), decryptedFilename)
+
+		for _, path := range []string{encryptedFilePath, decryptedFilePath} {
+			rule, err := sopsConfig.MatchCreationRule(path)
+			if err != nil {
+				return nil, err
+			}
+			if rule != nil && len(rule.AgeRecipients()) > 0 {
+				return rule.AgeRecipients(), nil
+			}
+		}
+	}
+
+	return defaultRecipients, nil
+}
+
+// RekeyFile updates the recipients of the encrypted file and rotates its
+// data key. The result is written to a temporary file next to the
+// encrypted file and renamed over it, so a failure never leaves a
+// partially written file behind.
+func RekeyFile(repoRoot string, plan RekeyPlan) error {
+	var encryptedFilePath string = filepath.Join(repoRoot, config.DockerServicesDir, plan.Service, plan.File.Filename)
+	fileType, _ := parseEncFilename(encryptedFilePath, plan.File.Filename)
+
+	var args []string
+	if fileType != "" {
+		args = append(args, "--input-type", fileType, "--output-type", fileType)
+	}
+	args = append(args, "--rotate")
+	if len(plan.AddRecipients) > 0 {
+		args = append(args, "--add-age", strings.Join(plan.AddRecipients, ","))
+	}
+	if len(plan.RemoveRecipients) > 0 {
+		args = append(args, "--rm-age", strings.Join(plan.RemoveRecipients, ","))
+	}
+	if len(plan.AddHcVaultTransitUris) > 0 {
+		args = append(args, "--add-hc-vault-transit", strings.Join(plan.AddHcVaultTransitUris, ","))
+	}
+	if len(plan.RemoveHcVaultTransitUris) > 0 {
+		args = append(args, "--rm-hc-vault-transit", strings.Join(plan.RemoveHcVaultTransitUris, ","))
+	}
+	args = append(args, encryptedFilePath)
+
+	out, err := exec.Command("sops", args...).Output()
+	if err != nil {
+		return fmt.Errorf("unable to rekey %s: %v", plan.File.Filename, sopsError(err))
+	}
+
+	return writeFileAtomic(encryptedFilePath, out)
+}
+
+// writeFileAtomic writes the content to a temporary file in the same
+// directory and renames it over the target path, preserving the file mode
+func writeFileAtomic(path string, content []byte) error {
+	var mode os.FileMode = 0644
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %v", path, err)
+	}
+	var tempPath string = tempFile.Name()
+	// Removing the temporary file is a no-op after it is renamed
+	defer os.Remove(tempPath)
+
+	if _, err := tempFile.Write(content); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to write to temporary file: %v", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to write to temporary file: %v", err)
+	}
+	if err := os.Chmod(tempPath, mode); err != nil {
+		return fmt.Errorf("failed to set the file mode of %s: %v", tempPath, err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", path, err)
+	}
+
+	return nil
+}
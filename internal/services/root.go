@@ -66,17 +66,9 @@ func verifyRepoRoot(path string) (string, error) {
 }
 
 func CreateLocalCacheDir(path string) (string, error) {
-	// use default path if empty
-	if path == "" {
-		var exePath, err = GetExecutableDir()
-		if err != nil {
-			return "", err
-		}
-		path = exePath
-	}
-
-	if !strings.HasSuffix(path, config.LocalConfigDir) {
-		path = filepath.Join(path, config.LocalConfigDir)
+	path, err := ResolveLocalCacheDir(path)
+	if err != nil {
+		return "", err
 	}
 
 	if _, err := os.Stat(path); err != nil {
@@ -93,6 +85,24 @@ func CreateLocalCacheDir(path string) (string, error) {
 	return path, nil
 }
 
+// ResolveLocalCacheDir returns the local cache directory for the given
+// path, or the directory of the binary when empty, without creating it
+func ResolveLocalCacheDir(path string) (string, error) {
+	// use default path if empty
+	if path == "" {
+		var exePath, err = GetExecutableDir()
+		if err != nil {
+			return "", err
+		}
+		path = exePath
+	}
+
+	if !strings.HasSuffix(path, config.LocalConfigDir) {
+		path = filepath.Join(path, config.LocalConfigDir)
+	}
+	return path, nil
+}
+
 func initConfig() {
 	viper.SetConfigType("yaml")
 	viper.SetConfigName("config")
@@ -0,0 +1,409 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+// A line containing this marker is never reported by the scanner
+const scanIgnoreMarker = "composectl:ignore"
+
+// The files larger than this are not scanned for credentials
+const scanMaxFileSize = 1 << 20
+
+// ScanFinding is a potential plaintext secret found by ScanSecrets
+type ScanFinding struct {
+	// The path relative to the repository root, with forward slashes
+	Path string
+	// The line of the finding, or 0 when it applies to the whole file
+	Line    int
+	Rule    string
+	Message string
+}
+
+type credentialPattern struct {
+	rule  string
+	regex *regexp.Regexp
+}
+
+// Well-known credential formats
+var credentialPatterns = []credentialPattern{
+	{rule: "private-key", regex: regexp.MustCompile(`-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`)},
+	{rule: "age-secret-key", regex: regexp.MustCompile(`AGE-SECRET-KEY-1[0-9A-Z]{58}`)},
+	{rule: "aws-access-key", regex: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{rule: "github-token", regex: regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})\b`)},
+	{rule: "gitlab-token", regex: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+	{rule: "slack-token", regex: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{rule: "stripe-key", regex: regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{20,}\b`)},
+	{rule: "google-api-key", regex: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+}
+
+// A long token made of base64 or url safe characters, a candidate for the entropy check
+var highEntropyTokenRegex = regexp.MustCompile(`[A-Za-z0-9+/=_-]{20,}`)
+
+// The minimum Shannon entropy (bits per character) of a token to be reported.
+// Hex strings such as image digests top out at 4 bits, so they are not reported.
+const highEntropyThreshold = 4.3
+
+// ScanSecrets looks for plaintext secrets that are about to be committed
+// (staged is true) or that are already tracked by git.
+//
+// It reports the decrypted counterpart of every encrypted service file
+// that is staged, tracked or not git ignored, and the well-known credential
+// formats and high entropy strings in the non-encrypted files under the
+// docker services directory. When staged is true, the staged content of
+// the files is scanned rather than the working tree.
+func ScanSecrets(repoRoot string, staged bool) ([]ScanFinding, error) {
+	var gitFiles []string
+	var err error
+	if staged {
+		// --relative lists the paths relative to the repo root like ls-files
+		gitFiles, err = gitListFiles(repoRoot, "diff", "--cached", "--name-only", "--relative", "--diff-filter=ACMR", "-z")
+	} else {
+		gitFiles, err = gitListFiles(repoRoot, "ls-files", "-z")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates map[string]bool = make(map[string]bool)
+	for _, file := range gitFiles {
+		candidates[file] = true
+	}
+
+	var findings []ScanFinding
+
+	// Plaintext counterpart of the encrypted files
+	serviceNames, err := ListAllService(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("error listing services: %v", err)
+	}
+	for _, name := range serviceNames {
+		files, err := ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving service's details: %v", err)
+		}
+
+		for _, file := range files {
+			relativePath, err := filepath.Rel(repoRoot, DecryptedFilePath(repoRoot, name, file))
+			if err != nil {
+				return nil, err
+			}
+			relativePath = filepath.ToSlash(relativePath)
+
+			if candidates[relativePath] {
+				var message string = "decrypted secret is tracked by git"
+				if staged {
+					message = "decrypted secret is staged for commit"
+				}
+				findings = append(findings, ScanFinding{Path: relativePath, Rule: "decrypted-secret", Message: message})
+				continue
+			}
+
+			ignored, err := isGitIgnored(repoRoot, relativePath)
+			if err != nil {
+				return nil, err
+			}
+			if !ignored {
+				findings = append(findings, ScanFinding{Path: relativePath, Rule: "decrypted-secret",
+					Message: "decrypted secret is not git ignored"})
+			}
+		}
+	}
+
+	// Credentials in the non-encrypted files of the services
+	var blobs *stagedBlobReader
+	if staged {
+		blobs, err = newStagedBlobReader(repoRoot)
+		if err != nil {
+			return nil, err
+		}
+		defer blobs.Close()
+	}
+
+	var servicesPrefix string = config.DockerServicesDir + "/"
+	for _, file := range gitFiles {
+		if !strings.HasPrefix(file, servicesPrefix) || IsEncryptedFile(file) {
+			continue
+		}
+
+		var content []byte
+		if staged {
+			content, err = blobs.Read(file)
+		} else {
+			content, err = readScanFile(repoRoot, file)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fileFindings, err := scanContentForCredentials(file, content)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, fileFindings...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		return findings[i].Line < findings[j].Line
+	})
+
+	return findings, nil
+}
+
+// readScanFile returns the content of the file in the working tree, or nil
+// when it is deleted, a directory or too large to be scanned
+func readScanFile(repoRoot string, file string) ([]byte, error) {
+	var path string = filepath.Join(repoRoot, filepath.FromSlash(file))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		// The file is deleted from the working tree
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if info.IsDir() || info.Size() > scanMaxFileSize {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", file, err)
+	}
+	return content, nil
+}
+
+// stagedBlobReader reads the staged content of the files from the index
+// with a single git cat-file process
+type stagedBlobReader struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func newStagedBlobReader(repoRoot string) (*stagedBlobReader, error) {
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = repoRoot
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to run git cat-file: %v", err)
+	}
+
+	return &stagedBlobReader{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// Read returns the staged content of the file, relative to the repo root,
+// or nil when it isn't in the index or is too large to be scanned
+func (r *stagedBlobReader) Read(file string) ([]byte, error) {
+	// ":./<path>" is the staged blob of the path relative to the working directory
+	if _, err := fmt.Fprintf(r.stdin, ":./%s\n", file); err != nil {
+		return nil, fmt.Errorf("unable to read the staged %s: %v", file, err)
+	}
+
+	header, err := r.stdout.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the staged %s: %v", file, err)
+	}
+
+	// "<oid> <type> <size>", or "<object> missing"
+	var fields []string = strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the staged %s: unexpected header %q", file, strings.TrimSpace(header))
+	}
+
+	// The content is followed by a newline
+	if fields[1] != "blob" || size > scanMaxFileSize {
+		if _, err := io.CopyN(io.Discard, r.stdout, size+1); err != nil {
+			return nil, fmt.Errorf("unable to read the staged %s: %v", file, err)
+		}
+		return nil, nil
+	}
+
+	var content []byte = make([]byte, size+1)
+	if _, err := io.ReadFull(r.stdout, content); err != nil {
+		return nil, fmt.Errorf("unable to read the staged %s: %v", file, err)
+	}
+	return content[:size], nil
+}
+
+func (r *stagedBlobReader) Close() error {
+	r.stdin.Close()
+	return r.cmd.Wait()
+}
+
+// scanContentForCredentials reports the well-known credential formats and
+// the high entropy strings in the content of the file
+func scanContentForCredentials(file string, content []byte) ([]ScanFinding, error) {
+	// Skip binary files
+	if bytes.IndexByte(content, 0) != -1 {
+		return nil, nil
+	}
+
+	var findings []ScanFinding
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), scanMaxFileSize)
+
+	var lineNumber int = 0
+	for scanner.Scan() {
+		lineNumber++
+		var line string = scanner.Text()
+		if strings.Contains(line, scanIgnoreMarker) {
+			continue
+		}
+
+		var matched bool = false
+		for _, pattern := range credentialPatterns {
+			if pattern.regex.MatchString(line) {
+				findings = append(findings, ScanFinding{Path: file, Line: lineNumber, Rule: pattern.rule,
+					Message: "possible " + strings.ReplaceAll(pattern.rule, "-", " ")})
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		for _, token := range highEntropyTokenRegex.FindAllString(line, -1) {
+			// Require both letters and digits, so that long paths and
+			// identifiers are not mistaken for a credential
+			if !strings.ContainsAny(token, "0123456789") || strings.IndexFunc(token, unicode.IsLetter) == -1 {
+				continue
+			}
+			if shannonEntropy(token) >= highEntropyThreshold {
+				findings = append(findings, ScanFinding{Path: file, Line: lineNumber, Rule: "high-entropy",
+					Message: "high entropy string, possibly a credential"})
+				break
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", file, err)
+	}
+
+	return findings, nil
+}
+
+// shannonEntropy returns the Shannon entropy of the string in bits per character
+func shannonEntropy(value string) float64 {
+	if value == "" {
+		return 0
+	}
+
+	var frequency map[rune]int = make(map[rune]int)
+	for _, char := range value {
+		frequency[char]++
+	}
+
+	var length float64 = float64(len([]rune(value)))
+	var entropy float64 = 0
+	for _, count := range frequency {
+		probability := float64(count) / length
+		entropy -= probability * math.Log2(probability)
+	}
+
+	return entropy
+}
+
+// gitListFiles runs a git command that prints NUL separated paths
+func gitListFiles(repoRoot string, args ...string) ([]string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoRoot
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to run git %s: %v", args[0], gitError(err))
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// isGitIgnored reports whether the path, which doesn't have to exist,
+// is ignored by the .gitignore rules of the repository. Nothing is
+// ignored when the repo root is not a git work tree.
+func isGitIgnored(repoRoot string, path string) (bool, error) {
+	cmd := exec.Command("git", "check-ignore", "-q", "--", path)
+	cmd.Dir = repoRoot
+
+	_, err := cmd.Output()
+	if err == nil {
+		return true, nil
+	}
+
+	// git check-ignore exits with 1 when the path is not ignored, and
+	// with 128 outside a work tree
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		if exitErr.ExitCode() == 128 && strings.Contains(string(exitErr.Stderr), "not a git repository") {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("unable to run git check-ignore: %v", gitError(err))
+}
+
+// gitError converts the error returned by running the git command into
+// a readable error that includes the message git printed to stderr
+func gitError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+// The default maximum age of a secret in days
+const DefaultSecretMaxAgeDays = 180
+
+// SecretAge is the time since a secret was last changed
+type SecretAge struct {
+	Service string
+	File    ServiceFile
+	// The zero time when it can't be determined
+	LastChanged time.Time
+	// Where LastChanged comes from: "sops" for the lastmodified field
+	// of the sops metadata, "git" for the last commit of the file, and
+	// "history" for the last commit that changed the decrypted content
+	Source     string
+	AgeDays    int
+	MaxAgeDays int
+	Expired    bool
+}
+
+// GetSecretAges returns the age of every encrypted secret of the given
+// services, compared against the maximum age of the policy, falling back
+// to the defaultMaxAgeDays.
+//
+// The sops lastmodified field is also updated when the file is re-encrypted
+// without changing the credentials, e.g. by rekey, team add and remove, the
+// merge driver and fix-eol. When history is true, the git history of the
+// file is decrypted instead to find the last commit that changed the
+// credentials, which requires the private key.
+func GetSecretAges(repoRoot string, serviceNames []string, policy *SecretsPolicy,
+	defaultMaxAgeDays int, now time.Time, history bool) ([]SecretAge, error) {
+	var ages []SecretAge
+	for _, name := range serviceNames {
+		files, err := ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving service's details: %v", err)
+		}
+
+		var maxAgeDays int = policy.MaxAgeDaysFor(name, defaultMaxAgeDays)
+		for _, file := range files {
+			var encryptedFilePath string = filepath.Join(repoRoot, config.DockerServicesDir, name, file.Filename)
+
+			var lastChanged time.Time
+			var source string
+			var err error
+			if history {
+				lastChanged, source, err = secretLastChangedInHistory(repoRoot, encryptedFilePath)
+			} else {
+				lastChanged, source, err = secretLastChanged(repoRoot, encryptedFilePath)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			var age SecretAge = SecretAge{Service: name, File: file, LastChanged: lastChanged,
+				Source: source, MaxAgeDays: maxAgeDays}
+			if !lastChanged.IsZero() {
+				age.AgeDays = int(now.Sub(lastChanged).Hours() / 24)
+				age.Expired = age.AgeDays > maxAgeDays
+			}
+			ages = append(ages, age)
+		}
+	}
+
+	return ages, nil
+}
+
+// secretLastChanged returns when the encrypted file was last changed, from
+// the lastmodified field that sops updates on every change, or the last
+// commit of the file when the metadata can't be read. The zero time is
+// returned when neither is available, e.g. outside a git work tree.
+func secretLastChanged(repoRoot string, encryptedFilePath string) (time.Time, string, error) {
+	if metadata, err := ReadSopsMetadata(encryptedFilePath); err == nil && !metadata.LastModified.IsZero() {
+		return metadata.LastModified, "sops", nil
+	}
+
+	commits, err := gitFileCommits(repoRoot, encryptedFilePath, "-1")
+	if err != nil || len(commits) == 0 {
+		// An uncommitted file has no history
+		return time.Time{}, "", nil
+	}
+	return commits[0].committed, "git", nil
+}
+
+// secretLastChangedInHistory returns the time of the last commit that
+// changed the decrypted content of the encrypted file, so that the commits
+// re-encrypting the same credentials are skipped. The uncommitted changes
+// of the file count as changed at the sops lastmodified time. The zero
+// time is returned when the file has no history.
+func secretLastChangedInHistory(repoRoot string, encryptedFilePath string) (time.Time, string, error) {
+	commits, err := gitFileCommits(repoRoot, encryptedFilePath)
+	if err != nil || len(commits) == 0 {
+		return time.Time{}, "", nil
+	}
+
+	var fileType string = GetEncryptedFileType(encryptedFilePath)
+	relativePath, err := filepath.Rel(repoRoot, encryptedFilePath)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	current, err := os.ReadFile(encryptedFilePath)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	newer, err := decryptEncryptedContent(current, fileType)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("unable to decrypt %s: %v", relativePath, err)
+	}
+
+	// The version of each commit is compared with the newer version, the
+	// working tree for the last commit
+	var changed time.Time
+	if metadata, err := ReadSopsMetadata(encryptedFilePath); err == nil {
+		changed = metadata.LastModified
+	}
+	for _, commit := range commits {
+		content, err := gitShowFile(repoRoot, commit.hash, relativePath)
+		if err != nil {
+			return time.Time{}, "", err
+		}
+		older, err := decryptEncryptedContent(content, fileType)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("unable to decrypt %s at %s: %v", relativePath, commit.hash, err)
+		}
+
+		if !contentEqual(older, newer) {
+			return changed, "history", nil
+		}
+		changed, newer = commit.committed, older
+	}
+
+	// Unchanged since the file was added
+	return changed, "history", nil
+}
+
+type gitFileCommit struct {
+	hash      string
+	committed time.Time
+}
+
+// gitFileCommits returns the commits that changed the file, newest first,
+// following renames
+func gitFileCommits(repoRoot string, path string, args ...string) ([]gitFileCommit, error) {
+	cmd := exec.Command("git", append(append([]string{"log", "--follow", "--format=%H %cI"}, args...), "--", path)...)
+	cmd.Dir = repoRoot
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to run git log: %v", gitError(err))
+	}
+
+	var commits []gitFileCommit
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		hash, date, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+		committed, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the git commit date %q: %v", date, err)
+		}
+		commits = append(commits, gitFileCommit{hash: hash, committed: committed})
+	}
+	return commits, nil
+}
+
+// gitShowFile returns the content of the file, relative to the repo root,
+// at the given commit
+func gitShowFile(repoRoot string, commit string, relativePath string) ([]byte, error) {
+	cmd := exec.Command("git", "show", commit+":./"+filepath.ToSlash(relativePath))
+	cmd.Dir = repoRoot
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to run git show: %v", gitError(err))
+	}
+	return out, nil
+}
+
+// decryptEncryptedContent decrypts the content of an encrypted file of the
+// given sops file type, where the empty type is a binary file
+func decryptEncryptedContent(content []byte, fileType string) ([]byte, error) {
+	if fileType == "" {
+		fileType = "binary"
+	}
+	return runSopsWithInput([]string{"--input-type", fileType, "--output-type", fileType, "-d"},
+		NormalizeLineEnding(content))
+}
@@ -17,10 +17,17 @@ limitations under the License.
 package services
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 
 	"github.com/AlstonChan/composectl/internal/config"
 )
@@ -95,3 +102,192 @@ func GetSopsAgeKeyPath() (string, error) {
 
 	return "", fmt.Errorf("no key file found")
 }
+
+// DefaultSopsAgeKeyPath returns the path of the age keys.txt file, even
+// if it doesn't exist yet. It is the existing file found by
+// GetSopsAgeKeyPath, otherwise the path sops looks for it first.
+func DefaultSopsAgeKeyPath() (string, error) {
+	if keysPath, err := GetSopsAgeKeyPath(); err == nil {
+		return keysPath, nil
+	}
+
+	if keysPath := os.Getenv(config.SopsAgeKeyFileEnv); keysPath != "" {
+		return keysPath, nil
+	}
+
+	if runtime.GOOS == "windows" {
+		if appDataPath := os.Getenv("APPDATA"); appDataPath != "" {
+			return filepath.Join(appDataPath, "sops", "age", "keys.txt"), nil
+		}
+	} else if configPath := os.Getenv("XDG_CONFIG_HOME"); configPath != "" {
+		return filepath.Join(configPath, "sops", "age", "keys.txt"), nil
+	}
+
+	userDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine $HOME directory to locate keys.txt")
+	}
+	return filepath.Join(userDir, ".config", "sops", "age", "keys.txt"), nil
+}
+
+// sopsError converts the error returned by running the sops command into
+// a readable error that includes the message sops printed to stderr
+func sopsError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("sops: %s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
+
+// The character set of the bech32 encoding used by age keys
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// The SSH public key types that age accepts as recipients
+var sshRecipientTypes = []string{"ssh-ed25519", "ssh-rsa"}
+
+// ValidateAgeRecipient checks that the recipient is a well formed
+// age public key, e.g. "age1" followed by 58 bech32 characters,
+// or an ssh-ed25519 or ssh-rsa public key
+func ValidateAgeRecipient(recipient string) error {
+	if strings.HasPrefix(recipient, "ssh-") {
+		return validateSshRecipient(recipient)
+	}
+
+	if len(recipient) != 62 || !strings.HasPrefix(recipient, "age1") {
+		return fmt.Errorf("invalid age public key %q, expected 62 characters starting with age1", recipient)
+	}
+
+	for _, char := range strings.TrimPrefix(recipient, "age1") {
+		if !strings.ContainsRune(bech32Charset, char) {
+			return fmt.Errorf("invalid age public key %q, unexpected character %q", recipient, char)
+		}
+	}
+
+	return nil
+}
+
+// validateSshRecipient checks that the recipient is an SSH public key in
+// the authorized_keys format that age accepts, e.g. "ssh-ed25519 AAAA..."
+func validateSshRecipient(recipient string) error {
+	fields := strings.Fields(recipient)
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid SSH public key %q, expected the key type followed by the base64 key", recipient)
+	}
+	if !slices.Contains(sshRecipientTypes, fields[0]) {
+		return fmt.Errorf("unsupported SSH public key type %q, expected one of %s", fields[0], strings.Join(sshRecipientTypes, ", "))
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return fmt.Errorf("invalid SSH public key %q: %v", fields[1], err)
+	}
+
+	// The key blob starts with the key type as a length prefixed string
+	if len(blob) < 4 {
+		return fmt.Errorf("invalid SSH public key %q, the key is truncated", fields[1])
+	}
+	var typeLength int = int(binary.BigEndian.Uint32(blob[:4]))
+	if len(blob) < 4+typeLength || string(blob[4:4+typeLength]) != fields[0] {
+		return fmt.Errorf("invalid SSH public key, the key doesn't match the type %s", fields[0])
+	}
+	// An ed25519 key is followed by the 32 bytes public key as a length prefixed string
+	if fields[0] == "ssh-ed25519" && len(blob) != 4+typeLength+4+32 {
+		return fmt.Errorf("invalid SSH public key, the ed25519 key is not 32 bytes")
+	}
+
+	return nil
+}
+
+// NormalizeAgeRecipient returns the recipient in the form passed to sops.
+// The comment of an SSH public key is dropped, leaving the key type and
+// the base64 key, so that the same key always compares equal.
+func NormalizeAgeRecipient(recipient string) string {
+	recipient = strings.TrimSpace(recipient)
+	if strings.HasPrefix(recipient, "ssh-") {
+		if fields := strings.Fields(recipient); len(fields) >= 2 {
+			return fields[0] + " " + fields[1]
+		}
+	}
+	return recipient
+}
+
+// GetSopsAgeSshKeyPath returns the SSH private key that sops uses as an
+// age identity: the key specified by SOPS_AGE_SSH_PRIVATE_KEY_FILE,
+// otherwise ~/.ssh/id_ed25519 or ~/.ssh/id_rsa.
+func GetSopsAgeSshKeyPath() (string, error) {
+	if keyPath := os.Getenv(config.SopsAgeSshPrivateKeyFileEnv); keyPath != "" {
+		if _, err := os.Stat(keyPath); err != nil {
+			return "", fmt.Errorf("SSH private key not found at the path specified by %s", config.SopsAgeSshPrivateKeyFileEnv)
+		}
+		return keyPath, nil
+	}
+
+	userDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine $HOME directory to locate the SSH private key")
+	}
+
+	for _, filename := range []string{"id_ed25519", "id_rsa"} {
+		var keyPath string = filepath.Join(userDir, ".ssh", filename)
+		if _, err := os.Stat(keyPath); err == nil {
+			return keyPath, nil
+		}
+	}
+
+	return "", fmt.Errorf("no SSH private key found in %s", filepath.Join(userDir, ".ssh"))
+}
+
+// CheckAgeIdentity checks that sops has an age identity to decrypt with,
+// either the keys.txt file or an SSH private key
+func CheckAgeIdentity() error {
+	_, keysErr := GetSopsAgeKeyPath()
+	if keysErr == nil {
+		return nil
+	}
+	if _, err := GetSopsAgeSshKeyPath(); err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%v, and no SSH private key was found in ~/.ssh or %s", keysErr, config.SopsAgeSshPrivateKeyFileEnv)
+}
+
+// CheckDecryptIdentity checks that sops can decrypt the encrypted file.
+// A file encrypted to a Vault transit key can be decrypted with the Vault
+// token alone, otherwise an age identity is required.
+func CheckDecryptIdentity(encryptedFilePath string) error {
+	if metadata, err := ReadSopsMetadata(encryptedFilePath); err == nil && len(metadata.HcVaultTransitUris) > 0 {
+		return nil
+	}
+	return CheckAgeIdentity()
+}
+
+// runSopsWithInput runs sops with the given arguments on the content
+// instead of a file, and returns its output. The content is piped to sops,
+// except on Windows where there is no /dev/stdin and a private temporary
+// file is used instead.
+func runSopsWithInput(args []string, content []byte) ([]byte, error) {
+	var cmd *exec.Cmd = nil
+	if runtime.GOOS == "windows" {
+		tempDir, err := os.MkdirTemp("", "composectl-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		var tempFile string = filepath.Join(tempDir, "input")
+		if err := os.WriteFile(tempFile, content, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write temporary file: %v", err)
+		}
+		cmd = exec.Command("sops", append(args, tempFile)...)
+	} else {
+		cmd = exec.Command("sops", append(args, "/dev/stdin")...)
+		cmd.Stdin = bytes.NewReader(content)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, sopsError(err)
+	}
+	return out, nil
+}
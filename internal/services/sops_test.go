@@ -0,0 +1,164 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+// sshPublicKey returns an authorized_keys line of the given type with the
+// fields of the key blob, each written as a length prefixed string
+func sshPublicKey(keyType string, fields ...[]byte) string {
+	var blob bytes.Buffer
+	for _, field := range append([][]byte{[]byte(keyType)}, fields...) {
+		binary.Write(&blob, binary.BigEndian, uint32(len(field)))
+		blob.Write(field)
+	}
+	return keyType + " " + base64.StdEncoding.EncodeToString(blob.Bytes())
+}
+
+func TestValidateAgeRecipient(t *testing.T) {
+	_, ageRecipient := testAgeKeyPair(t)
+	var ed25519Key string = sshPublicKey("ssh-ed25519", bytes.Repeat([]byte{0x42}, 32))
+	var rsaKey string = sshPublicKey("ssh-rsa", []byte{0x01, 0x00, 0x01}, bytes.Repeat([]byte{0xc3}, 256))
+
+	var tests = []struct {
+		name      string
+		recipient string
+		wantErr   bool
+	}{
+		{"age public key", ageRecipient, false},
+		{"age public key too short", ageRecipient[:61], true},
+		{"age public key with an invalid character", ageRecipient[:61] + "b", true},
+		{"age secret key", "AGE-SECRET-KEY-1" + strings.Repeat("Q", 58), true},
+		{"ssh-ed25519", ed25519Key, false},
+		{"ssh-ed25519 with a comment", ed25519Key + " alice@laptop", false},
+		{"ssh-rsa", rsaKey, false},
+		{"unsupported key type", sshPublicKey("ssh-dss", bytes.Repeat([]byte{0x01}, 20)), true},
+		{"key type without the key", "ssh-ed25519", true},
+		{"invalid base64", "ssh-ed25519 not-base64!", true},
+		{"truncated key", "ssh-ed25519 " + base64.StdEncoding.EncodeToString([]byte{0x00, 0x00}), true},
+		{"key of another type", "ssh-ed25519 " + strings.Fields(rsaKey)[1], true},
+		{"ed25519 key of the wrong length", sshPublicKey("ssh-ed25519", bytes.Repeat([]byte{0x42}, 31)), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateAgeRecipient(test.recipient); (err != nil) != test.wantErr {
+				t.Errorf("ValidateAgeRecipient(%q) error = %v, wantErr %v", test.recipient, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeAgeRecipient(t *testing.T) {
+	var ed25519Key string = sshPublicKey("ssh-ed25519", bytes.Repeat([]byte{0x42}, 32))
+
+	var tests = []struct {
+		recipient string
+		want      string
+	}{
+		{"age1abc", "age1abc"},
+		{"  age1abc\n", "age1abc"},
+		{ed25519Key, ed25519Key},
+		{ed25519Key + " alice@laptop", ed25519Key},
+		{"  " + strings.Replace(ed25519Key, " ", "\t", 1) + "  bob  ", ed25519Key},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeAgeRecipient(test.recipient); got != test.want {
+			t.Errorf("NormalizeAgeRecipient(%q) = %q, want %q", test.recipient, got, test.want)
+		}
+	}
+}
+
+func TestReadSshPublicKey(t *testing.T) {
+	var directory string = t.TempDir()
+	var ed25519Key string = sshPublicKey("ssh-ed25519", bytes.Repeat([]byte{0x42}, 32))
+
+	var privateKeyPath string = filepath.Join(directory, "id_ed25519")
+	if err := os.WriteFile(privateKeyPath+".pub", []byte(ed25519Key+" alice@laptop\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := readSshPublicKey(privateKeyPath)
+	if err != nil {
+		t.Fatalf("readSshPublicKey() error = %v", err)
+	}
+	if publicKey != ed25519Key {
+		t.Errorf("readSshPublicKey() = %q, want %q", publicKey, ed25519Key)
+	}
+
+	var invalidKeyPath string = filepath.Join(directory, "id_invalid")
+	if err := os.WriteFile(invalidKeyPath+".pub", []byte("ssh-ed25519 AAAA\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSshPublicKey(invalidKeyPath); err == nil {
+		t.Errorf("readSshPublicKey() of an invalid key, want an error")
+	}
+
+	if _, err := readSshPublicKey(filepath.Join(directory, "id_rsa")); err == nil {
+		t.Errorf("readSshPublicKey() without a .pub file, want an error")
+	}
+}
+
+func TestGetSopsAgeSshKeyPath(t *testing.T) {
+	var home string = t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(config.SopsAgeSshPrivateKeyFileEnv, "")
+
+	if _, err := GetSopsAgeSshKeyPath(); err == nil {
+		t.Errorf("GetSopsAgeSshKeyPath() without a key, want an error")
+	}
+
+	var rsaKeyPath string = filepath.Join(home, ".ssh", "id_rsa")
+	if err := os.MkdirAll(filepath.Dir(rsaKeyPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rsaKeyPath, []byte("private"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if keyPath, err := GetSopsAgeSshKeyPath(); err != nil || keyPath != rsaKeyPath {
+		t.Errorf("GetSopsAgeSshKeyPath() = %q, %v, want %q", keyPath, err, rsaKeyPath)
+	}
+
+	// id_ed25519 is preferred over id_rsa
+	var ed25519KeyPath string = filepath.Join(home, ".ssh", "id_ed25519")
+	if err := os.WriteFile(ed25519KeyPath, []byte("private"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if keyPath, err := GetSopsAgeSshKeyPath(); err != nil || keyPath != ed25519KeyPath {
+		t.Errorf("GetSopsAgeSshKeyPath() = %q, %v, want %q", keyPath, err, ed25519KeyPath)
+	}
+
+	// The environment variable takes precedence, and must exist
+	t.Setenv(config.SopsAgeSshPrivateKeyFileEnv, rsaKeyPath)
+	if keyPath, err := GetSopsAgeSshKeyPath(); err != nil || keyPath != rsaKeyPath {
+		t.Errorf("GetSopsAgeSshKeyPath() = %q, %v, want %q", keyPath, err, rsaKeyPath)
+	}
+	t.Setenv(config.SopsAgeSshPrivateKeyFileEnv, filepath.Join(home, "missing"))
+	if _, err := GetSopsAgeSshKeyPath(); err == nil {
+		t.Errorf("GetSopsAgeSshKeyPath() of a missing %s, want an error", config.SopsAgeSshPrivateKeyFileEnv)
+	}
+}
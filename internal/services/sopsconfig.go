@@ -0,0 +1,237 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The sops configuration filenames, in the order sops looks for them
+var sopsConfigFilenames = []string{".sops.yaml", ".sops.yml"}
+
+// SopsConfig is the repository .sops.yaml file
+type SopsConfig struct {
+	Path          string
+	CreationRules []SopsCreationRule `yaml:"creation_rules"`
+}
+
+// SopsCreationRule is a single creation rule of the .sops.yaml file.
+// Recipients may be specified directly on the rule, or in key groups.
+type SopsCreationRule struct {
+	PathRegex string          `yaml:"path_regex"`
+	Age       string          `yaml:"age"`
+	KeyGroups []SopsKeyGroups `yaml:"key_groups"`
+
+	// The comma separated master keys of the other types
+	Pgp               string `yaml:"pgp"`
+	Kms               string `yaml:"kms"`
+	GcpKms            string `yaml:"gcp_kms"`
+	AzureKeyVault     string `yaml:"azure_keyvault"`
+	HcVaultTransitUri string `yaml:"hc_vault_transit_uri"`
+
+	// The partial encryption and the Shamir settings of the rule
+	EncryptedRegex    string `yaml:"encrypted_regex"`
+	UnencryptedSuffix string `yaml:"unencrypted_suffix"`
+	UnencryptedRegex  string `yaml:"unencrypted_regex"`
+	EncryptedSuffix   string `yaml:"encrypted_suffix"`
+	ShamirThreshold   int    `yaml:"shamir_threshold"`
+}
+
+type SopsKeyGroups struct {
+	Age     []string `yaml:"age"`
+	Pgp     []string `yaml:"pgp"`
+	HcVault []string `yaml:"hc_vault"`
+	Kms     []struct {
+		Arn  string `yaml:"arn"`
+		Role string `yaml:"role"`
+	} `yaml:"kms"`
+	GcpKms []struct {
+		ResourceId string `yaml:"resource_id"`
+	} `yaml:"gcp_kms"`
+	AzureKeyVault []struct {
+		VaultUrl string `yaml:"vaultUrl"`
+		Key      string `yaml:"key"`
+		Version  string `yaml:"version"`
+	} `yaml:"azure_keyvault"`
+}
+
+// LoadSopsConfig loads the .sops.yaml file at the repository root. A nil
+// config is returned without error when the repository doesn't have one.
+func LoadSopsConfig(repoRoot string) (*SopsConfig, error) {
+	for _, filename := range sopsConfigFilenames {
+		var configPath string = filepath.Join(repoRoot, filename)
+
+		content, err := os.ReadFile(configPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to read %s: %v", configPath, err)
+		}
+
+		var sopsConfig SopsConfig
+		if err := yaml.Unmarshal(content, &sopsConfig); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %v", configPath, err)
+		}
+		sopsConfig.Path = configPath
+
+		return &sopsConfig, nil
+	}
+
+	return nil, nil
+}
+
+// MatchCreationRule returns the first creation rule that matches the file,
+// the same way sops picks the rule. The path_regex is matched against the
+// path relative to the directory of the .sops.yaml file.
+func (c *SopsConfig) MatchCreationRule(filePath string) (*SopsCreationRule, error) {
+	var configDir string = filepath.Dir(c.Path)
+
+	relativePath, err := filepath.Rel(configDir, filePath)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		relativePath = filePath
+	}
+	relativePath = filepath.ToSlash(relativePath)
+
+	for index := range c.CreationRules {
+		var rule *SopsCreationRule = &c.CreationRules[index]
+		if rule.PathRegex == "" {
+			return rule, nil
+		}
+
+		reg, err := regexp.Compile(rule.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_regex %q in %s: %v", rule.PathRegex, c.Path, err)
+		}
+		if reg.MatchString(relativePath) {
+			return rule, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// AgeRecipients returns all age recipients of the creation rule
+func (r *SopsCreationRule) AgeRecipients() []string {
+	var recipients []string = SplitRecipients(r.Age)
+	for _, group := range r.KeyGroups {
+		for _, recipient := range group.Age {
+			recipients = append(recipients, SplitRecipients(recipient)...)
+		}
+	}
+	return recipients
+}
+
+// MasterKeys returns the age recipients of the creation rule followed by
+// its master keys of the other types, in the format of SopsMetadata.MasterKeys
+func (r *SopsCreationRule) MasterKeys() []string {
+	var keys []string = r.AgeRecipients()
+	for _, value := range []string{r.Pgp, r.GcpKms, r.AzureKeyVault, r.HcVaultTransitUri} {
+		keys = append(keys, SplitList(value)...)
+	}
+	for _, arn := range SplitList(r.Kms) {
+		// Without the role to assume after a "+"
+		arn, _, _ = strings.Cut(arn, "+")
+		keys = append(keys, arn)
+	}
+
+	for _, group := range r.KeyGroups {
+		keys = append(keys, group.Pgp...)
+		keys = append(keys, group.HcVault...)
+		for _, key := range group.Kms {
+			keys = append(keys, key.Arn)
+		}
+		for _, key := range group.GcpKms {
+			keys = append(keys, key.ResourceId)
+		}
+		for _, key := range group.AzureKeyVault {
+			keys = append(keys, strings.TrimSuffix(key.VaultUrl, "/")+"/keys/"+key.Key+"/"+key.Version)
+		}
+	}
+	return keys
+}
+
+// KeyOptions returns the master keys and the partial encryption settings
+// of the creation rule as encrypt options, so that other recipients can be
+// added to the keys of the rule. It fails when the rule uses settings that
+// can't be given to sops on the command line.
+func (r *SopsCreationRule) KeyOptions() (EncryptOptions, error) {
+	if len(r.KeyGroups) > 1 || r.ShamirThreshold > 0 {
+		return EncryptOptions{}, fmt.Errorf("the creation rule %q uses key groups, add the recipients to the rule instead", r.PathRegex)
+	}
+	if r.UnencryptedRegex != "" || r.EncryptedSuffix != "" {
+		return EncryptOptions{}, fmt.Errorf("the creation rule %q uses a partial encryption setting that can't be kept, add the recipients to the rule instead",
+			r.PathRegex)
+	}
+
+	var options EncryptOptions = EncryptOptions{
+		Recipients:         r.AgeRecipients(),
+		HcVaultTransitUris: SplitList(r.HcVaultTransitUri),
+		PgpFingerprints:    SplitList(r.Pgp),
+		KmsArns:            SplitList(r.Kms),
+		GcpKmsResourceIds:  SplitList(r.GcpKms),
+		AzureKeyVaultUrls:  SplitList(r.AzureKeyVault),
+		EncryptedRegex:     r.EncryptedRegex,
+		UnencryptedSuffix:  r.UnencryptedSuffix,
+	}
+
+	for _, group := range r.KeyGroups {
+		options.PgpFingerprints = append(options.PgpFingerprints, group.Pgp...)
+		options.HcVaultTransitUris = append(options.HcVaultTransitUris, group.HcVault...)
+		for _, key := range group.Kms {
+			// sops takes the role to assume after a "+"
+			if key.Role != "" {
+				options.KmsArns = append(options.KmsArns, key.Arn+"+"+key.Role)
+			} else {
+				options.KmsArns = append(options.KmsArns, key.Arn)
+			}
+		}
+		for _, key := range group.GcpKms {
+			options.GcpKmsResourceIds = append(options.GcpKmsResourceIds, key.ResourceId)
+		}
+		for _, key := range group.AzureKeyVault {
+			options.AzureKeyVaultUrls = append(options.AzureKeyVaultUrls, strings.TrimSuffix(key.VaultUrl, "/")+"/keys/"+key.Key+"/"+key.Version)
+		}
+	}
+	return options, nil
+}
+
+// SplitRecipients splits a comma separated list of recipients the same
+// way sops does, ignoring whitespace and empty entries. The recipients
+// are normalized with NormalizeAgeRecipient.
+func SplitRecipients(value string) []string {
+	return normalizeAgeRecipients(SplitList(value))
+}
+
+// SplitList splits a comma separated config value, ignoring whitespace
+// and empty entries
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
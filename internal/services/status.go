@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 	"sort"
 	"strings"
 )
@@ -41,37 +42,111 @@ const (
 	PartiallyRunning
 	Running
 	Unused
+	// Some containers are running but unhealthy, or run next to
+	// containers that exited with an error or are dead
+	Degraded
+	// A container is restarting, usually crash looping
+	Restarting
+	// No container is running and a container exited with an error
+	Failed
+	// The containers were created but never started
+	Created
+	// The containers are paused
+	Paused
+	// No container is running and a container is dead
+	Dead
 )
 
+// The relevance of the states when picking the active compose file of a
+// service, from the most relevant
+var serviceStateRelevance []ServiceState = []ServiceState{
+	Restarting, Degraded, PartiallyRunning, Running, Paused, Failed, Dead, Created, Stopped, Unused,
+}
+
 type composeService struct {
-	Name   string `json:"Service"`
-	Status string `json:"State"`
+	Name      string `json:"Service"`
+	Status    string `json:"State"`
+	Container string `json:"Name"`
+	Health    string `json:"Health"`
+	ExitCode  int    `json:"ExitCode"`
+}
+
+// ContainerStatus is the state of a container of a compose file
+type ContainerStatus struct {
+	Name string
+	// The name of the service in the compose file
+	Service string
+	// The docker state, e.g. "running", "exited" or "restarting"
+	State string
+	// The health check status, "healthy", "unhealthy" or "starting",
+	// empty when the container has no health check
+	Health string
+	// The exit code of an exited container
+	ExitCode int
 }
 
 type composeFileStatus struct {
 	ServiceState
-	Label string
-	File  string
+	Label      string
+	File       string
+	Containers []ContainerStatus
+}
+
+// HealthCount returns the number of healthy containers and the number of
+// containers with a health check
+func (s composeFileStatus) HealthCount() (int, int) {
+	var healthy, checked int = 0, 0
+	for _, container := range s.Containers {
+		if container.Health == "" {
+			continue
+		}
+		checked++
+		if container.Health == "healthy" {
+			healthy++
+		}
+	}
+	return healthy, checked
+}
+
+// IsActive reports whether containers of the service are up, even if
+// they are unhealthy, restarting or paused
+func (s ServiceState) IsActive() bool {
+	switch s {
+	case Running, PartiallyRunning, Degraded, Restarting, Paused:
+		return true
+	default:
+		return false
+	}
 }
 
-func GetActiveServiceState(projectDir string) (composeFileStatus, error) {
-	var services, err = GetAllServiceState(projectDir)
+// GetActiveServiceState returns the state of the most relevant compose file
+// of the service: a crash looping or degraded compose file first, then a
+// running one, then one with stopped containers, then the base compose file.
+// See GetAllServiceState.
+func GetActiveServiceState(projectDir string, containers *ComposeContainers) (composeFileStatus, error) {
+	var services, err = GetAllServiceState(projectDir, containers)
 	if err != nil {
 		return composeFileStatus{ServiceState: Unused, Label: ""}, err
 	}
+	// A service directory without a compose file has nothing running
+	if len(services) == 0 {
+		return composeFileStatus{ServiceState: Unused, Label: ""}, nil
+	}
 
 	var activeService composeFileStatus = services[0]
-	for _, service := range services {
-		if service.ServiceState == PartiallyRunning || service.ServiceState == Running {
+	for _, service := range services[1:] {
+		if slices.Index(serviceStateRelevance, service.ServiceState) < slices.Index(serviceStateRelevance, activeService.ServiceState) {
 			activeService = service
-			break
 		}
 	}
 
 	return activeService, nil
 }
 
-func GetAllServiceState(projectDir string) ([]composeFileStatus, error) {
+// GetAllServiceState returns the state of every compose file of the service.
+// The state is resolved from the containers snapshot, or by running
+// 'docker compose ps' for each compose file when the snapshot is nil.
+func GetAllServiceState(projectDir string, containers *ComposeContainers) ([]composeFileStatus, error) {
 	var allComposeFiles, err = FindComposeFiles(projectDir)
 	if err != nil {
 		return nil, err
@@ -79,7 +154,14 @@ func GetAllServiceState(projectDir string) ([]composeFileStatus, error) {
 
 	var services []composeFileStatus = make([]composeFileStatus, len(allComposeFiles))
 	for index, file := range allComposeFiles {
-		state, err := GetServiceState(projectDir, file)
+		var state ServiceState
+		var fileContainers []ContainerStatus
+		var err error
+		if containers != nil {
+			state, fileContainers = containers.ServiceState(projectDir, file)
+		} else {
+			state, fileContainers, err = GetServiceState(projectDir, file)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error getting service state for %s: %v\n", file, err)
 			continue
@@ -91,7 +173,7 @@ func GetAllServiceState(projectDir string) ([]composeFileStatus, error) {
 			continue
 		}
 
-		services[index] = composeFileStatus{ServiceState: state, Label: label, File: file}
+		services[index] = composeFileStatus{ServiceState: state, Label: label, File: file, Containers: fileContainers}
 	}
 
 	// Sort the service label, with empty string at the first
@@ -109,57 +191,84 @@ func GetAllServiceState(projectDir string) ([]composeFileStatus, error) {
 	return services, nil
 }
 
-func GetServiceState(projectDir string, composeFile string) (ServiceState, error) {
-	cmd := exec.Command("docker", "compose", "-f", composeFile, "ps", "--format", "json")
+func GetServiceState(projectDir string, composeFile string) (ServiceState, []ContainerStatus, error) {
+	cmd := exec.Command("docker", "compose", "-f", composeFile, "ps", "--all", "--format", "json")
 	cmd.Dir = projectDir
 
 	out, err := cmd.Output()
 	if err != nil {
-		return Unused, nil
+		return Unused, nil, nil
 	}
 
 	// docker compose ps returns nothing when there are
 	// no containers at any status.
 	if len(out) == 0 {
-		return Unused, nil
+		return Unused, nil, nil
 	}
 
-	var services []composeService
+	var containers []ContainerStatus
 
 	// Use a decoder to read (multiple) JSON objects in sequence
 	dec := json.NewDecoder(bytes.NewReader(out))
 	for dec.More() {
 		var container composeService
 		if err := dec.Decode(&container); err != nil {
-			return Stopped, fmt.Errorf("error decoding docker compose ps (json) output: %v", err)
+			return Stopped, nil, fmt.Errorf("error decoding docker compose ps (json) output: %v", err)
 		}
-		services = append(services, container)
+		containers = append(containers, ContainerStatus{Name: container.Container, Service: container.Name,
+			State: container.Status, Health: container.Health, ExitCode: container.ExitCode})
 	}
 
-	if len(services) == 0 {
-		return Unused, nil
+	return composeServiceState(containers), containers, nil
+}
+
+// composeServiceState returns the state of a compose file from the
+// states of its containers
+func composeServiceState(containers []ContainerStatus) ServiceState {
+	if len(containers) == 0 {
+		return Unused
 	}
 
-	runningCount := 0
-	stoppedCount := 0
-	for _, svc := range services {
-		switch svc.Status {
+	var running, paused, created, failed, dead, unhealthy int = 0, 0, 0, 0, 0, 0
+	for _, container := range containers {
+		switch container.State {
+		case "restarting":
+			return Restarting
 		case "running":
-			runningCount++
-		case "stopped":
-			stoppedCount++
+			running++
+			if container.Health == "unhealthy" {
+				unhealthy++
+			}
+		case "paused":
+			paused++
+		case "created":
+			created++
+		case "exited":
+			if container.ExitCode != 0 {
+				failed++
+			}
+		case "dead":
+			dead++
 		}
 	}
 
 	switch {
-	case runningCount == len(services):
-		return Running, nil
-	case runningCount > 0 && stoppedCount > 0:
-		return PartiallyRunning, nil
-	case stoppedCount == len(services):
-		return Stopped, nil
+	case running > 0 && (unhealthy > 0 || failed > 0 || dead > 0):
+		return Degraded
+	case running == len(containers):
+		return Running
+	case running > 0:
+		return PartiallyRunning
+	case paused > 0:
+		return Paused
+	case dead > 0:
+		return Dead
+	case failed > 0:
+		return Failed
+	case created == len(containers):
+		return Created
 	default:
-		return Unused, nil
+		return Stopped
 	}
 }
 
@@ -173,11 +282,34 @@ func GetServiceStatusString(state ServiceState) string {
 		return "Running"
 	case Unused:
 		return "Unused"
+	case Degraded:
+		return "Degraded"
+	case Restarting:
+		return "Restarting"
+	case Failed:
+		return "Failed"
+	case Created:
+		return "Created"
+	case Paused:
+		return "Paused"
+	case Dead:
+		return "Dead"
 	default:
 		return fmt.Sprintf("ServiceState(%d)", state)
 	}
 }
 
+// GetComposeFileStatusString returns the state of the compose file with
+// the health of its containers when they have health checks, e.g.
+// "Degraded (2/3 healthy)"
+func GetComposeFileStatusString(status composeFileStatus) string {
+	var statusString string = GetServiceStatusString(status.ServiceState)
+	if healthy, checked := status.HealthCount(); checked > 0 {
+		statusString += fmt.Sprintf(" (%d/%d healthy)", healthy, checked)
+	}
+	return statusString
+}
+
 func GetDecryptedFilesStatus(root string, serviceName string) ServiceDecryptionStatus {
 	files, err := ResolveServiceFiles(root, serviceName, true)
 	if err != nil {
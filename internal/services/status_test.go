@@ -0,0 +1,188 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/moby/moby/api/types/container"
+)
+
+func TestComposeServiceState(t *testing.T) {
+	var running ContainerStatus = ContainerStatus{State: "running"}
+	var healthy ContainerStatus = ContainerStatus{State: "running", Health: "healthy"}
+	var unhealthy ContainerStatus = ContainerStatus{State: "running", Health: "unhealthy"}
+	var starting ContainerStatus = ContainerStatus{State: "running", Health: "starting"}
+	var exited ContainerStatus = ContainerStatus{State: "exited", ExitCode: 0}
+	var failed ContainerStatus = ContainerStatus{State: "exited", ExitCode: 1}
+	var killed ContainerStatus = ContainerStatus{State: "exited", ExitCode: 137}
+	var restarting ContainerStatus = ContainerStatus{State: "restarting"}
+	var paused ContainerStatus = ContainerStatus{State: "paused"}
+	var created ContainerStatus = ContainerStatus{State: "created"}
+	var dead ContainerStatus = ContainerStatus{State: "dead"}
+
+	var tests = []struct {
+		name       string
+		containers []ContainerStatus
+		want       ServiceState
+	}{
+		{"no container", nil, Unused},
+		{"all running", []ContainerStatus{running, healthy}, Running},
+		{"health check starting", []ContainerStatus{starting}, Running},
+		{"running and exited cleanly", []ContainerStatus{running, exited}, PartiallyRunning},
+		{"running and created", []ContainerStatus{running, created}, PartiallyRunning},
+		{"running and paused", []ContainerStatus{running, paused}, PartiallyRunning},
+		{"running and unhealthy", []ContainerStatus{healthy, unhealthy}, Degraded},
+		{"only unhealthy", []ContainerStatus{unhealthy}, Degraded},
+		{"running and failed", []ContainerStatus{running, failed}, Degraded},
+		{"running and dead", []ContainerStatus{running, dead}, Degraded},
+		{"restarting", []ContainerStatus{restarting}, Restarting},
+		{"restarting next to running", []ContainerStatus{running, restarting, failed}, Restarting},
+		{"paused", []ContainerStatus{paused, exited}, Paused},
+		{"paused and failed", []ContainerStatus{paused, failed}, Paused},
+		{"dead", []ContainerStatus{dead, failed}, Dead},
+		{"failed", []ContainerStatus{failed, exited}, Failed},
+		{"killed", []ContainerStatus{killed}, Failed},
+		{"created", []ContainerStatus{created, created}, Created},
+		{"created and exited", []ContainerStatus{created, exited}, Stopped},
+		{"stopped", []ContainerStatus{exited, exited}, Stopped},
+		{"unknown state", []ContainerStatus{{State: "removing"}}, Stopped},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := composeServiceState(test.containers); got != test.want {
+				t.Errorf("composeServiceState() = %s, want %s", GetServiceStatusString(got), GetServiceStatusString(test.want))
+			}
+		})
+	}
+}
+
+func TestServiceStateRelevance(t *testing.T) {
+	// Every state is ranked exactly once
+	for state := Stopped; state <= Dead; state++ {
+		var count int = 0
+		for _, ranked := range serviceStateRelevance {
+			if ranked == state {
+				count++
+			}
+		}
+		if count != 1 {
+			t.Errorf("%s is ranked %d times, want once", GetServiceStatusString(state), count)
+		}
+	}
+	if len(serviceStateRelevance) != int(Dead)+1 {
+		t.Errorf("serviceStateRelevance has %d states, want %d", len(serviceStateRelevance), int(Dead)+1)
+	}
+
+	var order []ServiceState = []ServiceState{Restarting, Degraded, PartiallyRunning, Running, Stopped, Unused}
+	for index := 1; index < len(order); index++ {
+		if slices.Index(serviceStateRelevance, order[index-1]) > slices.Index(serviceStateRelevance, order[index]) {
+			t.Errorf("%s is less relevant than %s", GetServiceStatusString(order[index-1]),
+				GetServiceStatusString(order[index]))
+		}
+	}
+}
+
+// composeContainer returns a container created by docker compose from
+// the compose file of the project directory
+func composeContainer(projectDir string, composeFile string, state string, status string) container.Summary {
+	return container.Summary{
+		Names:  []string{"/" + filepath.Base(projectDir) + "-app-1"},
+		State:  container.ContainerState(state),
+		Status: status,
+		Labels: map[string]string{
+			composeProjectLabel:     filepath.Base(projectDir),
+			composeServiceLabel:     "app",
+			composeWorkingDirLabel:  projectDir,
+			composeConfigFilesLabel: filepath.Join(projectDir, composeFile),
+		},
+	}
+}
+
+// testComposeContainers returns a snapshot of the given containers
+func testComposeContainers(summaries ...container.Summary) *ComposeContainers {
+	var containers *ComposeContainers = &ComposeContainers{
+		byConfigFile: make(map[string][]container.Summary),
+		byWorkingDir: make(map[string][]container.Summary),
+	}
+	for _, summary := range summaries {
+		var workingDir string = canonicalPath(summary.Labels[composeWorkingDirLabel])
+		containers.byWorkingDir[workingDir] = append(containers.byWorkingDir[workingDir], summary)
+		var configFile string = canonicalPath(summary.Labels[composeConfigFilesLabel])
+		containers.byConfigFile[configFile] = append(containers.byConfigFile[configFile], summary)
+	}
+	return containers
+}
+
+func TestGetActiveServiceState(t *testing.T) {
+	var projectDir string = t.TempDir()
+	for _, file := range []string{"compose.yml", "compose.dev.yml", "compose.prod.yml"} {
+		if err := os.WriteFile(filepath.Join(projectDir, file), []byte("services: {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		name       string
+		containers []container.Summary
+		wantState  ServiceState
+		wantLabel  string
+	}{
+		{"nothing created", nil, Unused, ""},
+		{"a running variant over the stopped base",
+			[]container.Summary{
+				composeContainer(projectDir, "compose.yml", "exited", "Exited (0) 1 hour ago"),
+				composeContainer(projectDir, "compose.dev.yml", "running", "Up 2 hours"),
+			}, Running, "dev"},
+		{"a crash looping variant over a running one",
+			[]container.Summary{
+				composeContainer(projectDir, "compose.dev.yml", "running", "Up 2 hours"),
+				composeContainer(projectDir, "compose.prod.yml", "restarting", "Restarting (1) 5 seconds ago"),
+			}, Restarting, "prod"},
+		{"a failed variant over the unused base",
+			[]container.Summary{
+				composeContainer(projectDir, "compose.prod.yml", "exited", "Exited (1) 3 minutes ago"),
+			}, Failed, "prod"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state, err := GetActiveServiceState(projectDir, testComposeContainers(test.containers...))
+			if err != nil {
+				t.Fatalf("GetActiveServiceState() error = %v", err)
+			}
+			if state.ServiceState != test.wantState || state.Label != test.wantLabel {
+				t.Errorf("GetActiveServiceState() = %s %q, want %s %q", GetServiceStatusString(state.ServiceState),
+					state.Label, GetServiceStatusString(test.wantState), test.wantLabel)
+			}
+		})
+	}
+
+	t.Run("no compose file", func(t *testing.T) {
+		state, err := GetActiveServiceState(t.TempDir(), testComposeContainers())
+		if err != nil {
+			t.Fatalf("GetActiveServiceState() error = %v", err)
+		}
+		if state.ServiceState != Unused {
+			t.Errorf("GetActiveServiceState() = %s, want Unused", GetServiceStatusString(state.ServiceState))
+		}
+	})
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IsStructuredFileType reports whether a sops file type can be
+// parsed into keys by FlattenStructuredSecret
+func IsStructuredFileType(fileType string) bool {
+	return fileType == "dotenv" || fileType == "yaml" || fileType == "json"
+}
+
+// FlattenStructuredSecret parses a decrypted dotenv, yaml or json secret
+// into a flat map of key to value. Nested keys of yaml and json are joined
+// with a dot and list items are indexed, e.g. "database.hosts[0]".
+func FlattenStructuredSecret(content []byte, fileType string) (map[string]string, error) {
+	var flat map[string]string = make(map[string]string)
+
+	switch fileType {
+	case "dotenv":
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			key, value, ok := parseDotenvLine(scanner.Text())
+			if ok {
+				flat[key] = value
+			}
+		}
+		return flat, scanner.Err()
+	case "yaml":
+		var document any
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, fmt.Errorf("unable to parse yaml: %v", err)
+		}
+		flattenStructuredValue("", document, flat)
+		return flat, nil
+	case "json":
+		var document any
+		if err := json.Unmarshal(content, &document); err != nil {
+			return nil, fmt.Errorf("unable to parse json: %v", err)
+		}
+		flattenStructuredValue("", document, flat)
+		return flat, nil
+	default:
+		return nil, fmt.Errorf("file type %q is not a structured format", fileType)
+	}
+}
+
+// parseDotenvLine parses a single dotenv line into its key and value.
+// Comments, empty lines and lines without "=" are ignored.
+func parseDotenvLine(line string) (key string, value string, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+
+	line = strings.TrimPrefix(line, "export ")
+	key, value, found := strings.Cut(line, "=")
+	if !found {
+		return "", "", false
+	}
+
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+
+	return key, value, key != ""
+}
+
+func flattenStructuredValue(prefix string, value any, flat map[string]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			var childKey string = key
+			if prefix != "" {
+				childKey = prefix + "." + key
+			}
+			flattenStructuredValue(childKey, child, flat)
+		}
+	case []any:
+		for index, child := range v {
+			flattenStructuredValue(prefix+"["+strconv.Itoa(index)+"]", child, flat)
+		}
+	case nil:
+		flat[prefix] = ""
+	default:
+		flat[prefix] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,357 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AlstonChan/composectl/internal/config"
+)
+
+type SecretSyncState int
+
+const (
+	// The decrypted file and the encrypted file can't be compared,
+	// usually because the private key is not available
+	SyncUnknown SecretSyncState = iota
+	// The encrypted file has no decrypted counterpart
+	NotDecrypted
+	// The decrypted file has the same content as the encrypted file
+	InSync
+	// The decrypted file was edited but has not been re-encrypted
+	Modified
+	// The encrypted file was updated after the decrypted file was written
+	Stale
+	// The service has no decrypted secrets to compare
+	SyncNIL
+	// Both the decrypted file and the encrypted file were changed since
+	// the secret was last decrypted or encrypted
+	Conflict
+)
+
+// syncBaseline is the state of a secret when composectl last decrypted or
+// encrypted it, so that the side that changed since can be told apart
+type syncBaseline struct {
+	Path            string `json:"path"`
+	PlaintextSha256 string `json:"plaintext_sha256"`
+	EncryptedMac    string `json:"encrypted_mac"`
+}
+
+// GetSecretSyncState compares the decrypted counterpart of an encrypted
+// service file with the encrypted file.
+//
+// When the secret was decrypted or encrypted by composectl, both sides are
+// compared with the baseline recorded at that time: the decrypted content
+// with its hash and the encrypted file with its sops mac. The encrypted
+// file is only decrypted when its mac changed, as a rekey changes the mac
+// without changing the content.
+//
+// Without a baseline, the content is compared by decrypting the encrypted
+// file, and the direction is decided by comparing the modification time of
+// the decrypted file with the time the encrypted file last changed (the
+// newer of its mtime and sops "lastmodified"). A Conflict can't be told
+// from Stale this way. When the encrypted file can't be decrypted, only
+// the timestamps are used, which can detect Stale but not tell InSync
+// from Modified.
+func GetSecretSyncState(repoRoot string, name string, file ServiceFile) (SecretSyncState, error) {
+	return secretSyncState(repoRoot, name, file, true)
+}
+
+// secretSyncState is GetSecretSyncState, which only reads the sops metadata
+// of the encrypted file when decrypt is false, as if it can't be decrypted
+func secretSyncState(repoRoot string, name string, file ServiceFile, decrypt bool) (SecretSyncState, error) {
+	var servicePath string = filepath.Join(repoRoot, config.DockerServicesDir, name)
+	var encryptedFilePath string = filepath.Join(servicePath, file.Filename)
+	var decryptedFilePath string = DecryptedFilePath(repoRoot, name, file)
+
+	decryptedInfo, err := os.Stat(decryptedFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NotDecrypted, nil
+		}
+		return SyncUnknown, err
+	}
+
+	decryptedContent, err := os.ReadFile(decryptedFilePath)
+	if err != nil {
+		return SyncUnknown, fmt.Errorf("unable to read %s: %v", decryptedFilePath, err)
+	}
+
+	if baseline, err := readSyncBaseline(decryptedFilePath); err == nil && baseline != nil {
+		return baselineSyncState(encryptedFilePath, decryptedContent, *baseline, decrypt)
+	}
+
+	encryptedTime, err := encryptedFileModTime(encryptedFilePath)
+	if err != nil {
+		return SyncUnknown, err
+	}
+	var isEncryptedNewer bool = encryptedTime.After(decryptedInfo.ModTime())
+
+	if !decrypt {
+		if isEncryptedNewer {
+			return Stale, nil
+		}
+		return SyncUnknown, nil
+	}
+
+	encryptedContent, err := DecryptToMemory(encryptedFilePath)
+	if err != nil {
+		if isEncryptedNewer {
+			return Stale, nil
+		}
+		return SyncUnknown, err
+	}
+
+	if contentEqual(decryptedContent, encryptedContent) {
+		return InSync, nil
+	}
+
+	if isEncryptedNewer {
+		return Stale, nil
+	}
+	return Modified, nil
+}
+
+// baselineSyncState returns the sync state of a secret from the changes
+// made to both sides since the baseline was recorded
+func baselineSyncState(encryptedFilePath string, decryptedContent []byte, baseline syncBaseline,
+	decrypt bool) (SecretSyncState, error) {
+	var isDecryptedChanged bool = plaintextDigest(decryptedContent) != baseline.PlaintextSha256
+
+	metadata, err := ReadSopsMetadata(encryptedFilePath)
+	if err != nil {
+		return SyncUnknown, err
+	}
+
+	if metadata.Mac == baseline.EncryptedMac {
+		if isDecryptedChanged {
+			return Modified, nil
+		}
+		return InSync, nil
+	}
+
+	var encryptedContent []byte
+	if decrypt {
+		encryptedContent, err = DecryptToMemory(encryptedFilePath)
+	}
+	if !decrypt || err != nil {
+		// The encrypted content can't be compared, so it is assumed to
+		// have changed along with the encrypted file
+		if isDecryptedChanged {
+			return Conflict, nil
+		}
+		return Stale, nil
+	}
+
+	if contentEqual(decryptedContent, encryptedContent) {
+		return InSync, nil
+	}
+
+	var isEncryptedChanged bool = plaintextDigest(encryptedContent) != baseline.PlaintextSha256
+	switch {
+	case isDecryptedChanged && isEncryptedChanged:
+		return Conflict, nil
+	case isEncryptedChanged:
+		return Stale, nil
+	default:
+		return Modified, nil
+	}
+}
+
+// GetServiceSyncStatus returns the most relevant sync state among all the
+// decrypted secrets of a service. Conflict has the highest precedence as
+// syncing it would lose changes, followed by Stale as it means the running
+// configuration is outdated, and Modified.
+//
+// When decrypt is false, the encrypted files are never decrypted and only
+// their sops metadata is compared, see GetSecretSyncState for the states
+// that can be told without decrypting. This is much faster for listing
+// many services.
+func GetServiceSyncStatus(repoRoot string, name string, decrypt bool) SecretSyncState {
+	files, err := ResolveServiceFiles(repoRoot, name, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving service's details: %v\n", err)
+		return SyncNIL
+	}
+
+	var precedence = []SecretSyncState{Conflict, Stale, Modified, SyncUnknown, InSync}
+	var found = make(map[SecretSyncState]bool)
+	for _, file := range files {
+		state, _ := secretSyncState(repoRoot, name, file, decrypt)
+		found[state] = true
+	}
+
+	for _, state := range precedence {
+		if found[state] {
+			return state
+		}
+	}
+
+	return SyncNIL
+}
+
+func GetSecretSyncStateString(state SecretSyncState) string {
+	switch state {
+	case SyncUnknown:
+		return "Unknown"
+	case NotDecrypted:
+		return "NotDecrypted"
+	case InSync:
+		return "InSync"
+	case Modified:
+		return "Modified"
+	case Stale:
+		return "Stale"
+	case SyncNIL:
+		return "NIL"
+	case Conflict:
+		return "Conflict"
+	default:
+		return fmt.Sprintf("SecretSyncState(%d)", state)
+	}
+}
+
+// encryptedFileModTime returns the newer of the encrypted file mtime and
+// the sops "lastmodified" metadata. The mtime catches files updated by
+// git pull, while lastmodified survives a fresh clone.
+func encryptedFileModTime(encryptedFilePath string) (time.Time, error) {
+	info, err := os.Stat(encryptedFilePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var modTime time.Time = info.ModTime()
+	if metadata, err := ReadSopsMetadata(encryptedFilePath); err == nil && metadata.LastModified.After(modTime) {
+		modTime = metadata.LastModified
+	}
+
+	return modTime, nil
+}
+
+// recordSyncBaseline records the plaintext content of a secret and the sops
+// mac of its encrypted file once composectl decrypted or encrypted it, as
+// both sides are in sync at this point
+func recordSyncBaseline(plaintextPath string, plaintext []byte, encryptedFilePath string) error {
+	metadata, err := ReadSopsMetadata(encryptedFilePath)
+	if err != nil {
+		return err
+	}
+	if metadata.Mac == "" {
+		return fmt.Errorf("no sops mac found in %s", encryptedFilePath)
+	}
+
+	baselinePath, absolutePath, err := syncBaselinePath(plaintextPath)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(syncBaseline{
+		Path:            absolutePath,
+		PlaintextSha256: plaintextDigest(plaintext),
+		EncryptedMac:    metadata.Mac,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(baselinePath), 0700); err != nil {
+		return fmt.Errorf("unable to create the sync baseline directory: %v", err)
+	}
+	if err := os.WriteFile(baselinePath, content, 0600); err != nil {
+		return fmt.Errorf("unable to write the sync baseline of %s: %v", plaintextPath, err)
+	}
+	return nil
+}
+
+// readSyncBaseline returns the recorded baseline of a decrypted secret, or
+// nil when the secret wasn't decrypted or encrypted by composectl
+func readSyncBaseline(plaintextPath string) (*syncBaseline, error) {
+	baselinePath, absolutePath, err := syncBaselinePath(plaintextPath)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(baselinePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var baseline syncBaseline
+	if err := json.Unmarshal(content, &baseline); err != nil {
+		return nil, fmt.Errorf("unable to parse the sync baseline of %s: %v", plaintextPath, err)
+	}
+	if baseline.Path != absolutePath {
+		return nil, nil
+	}
+	return &baseline, nil
+}
+
+// removeSyncBaseline removes the recorded baseline of a decrypted secret
+// once the decrypted file is removed
+func removeSyncBaseline(plaintextPath string) error {
+	baselinePath, _, err := syncBaselinePath(plaintextPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(baselinePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// syncBaselinePath returns the path of the baseline of a decrypted secret
+// in the local cache directory, named after the hash of its absolute path,
+// along with the absolute path
+func syncBaselinePath(plaintextPath string) (string, string, error) {
+	cacheDir, err := ResolveLocalCacheDir(os.Getenv(config.ConfigDirEnv))
+	if err != nil {
+		return "", "", err
+	}
+
+	absolutePath, err := filepath.Abs(plaintextPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	var sum [sha256.Size]byte = sha256.Sum256([]byte(absolutePath))
+	return filepath.Join(cacheDir, config.SyncBaselineDir, hex.EncodeToString(sum[:])+".json"), absolutePath, nil
+}
+
+// plaintextDigest returns the hash of the plaintext content of a secret,
+// ignoring the difference in line endings like contentEqual
+func plaintextDigest(content []byte) string {
+	var sum [sha256.Size]byte = sha256.Sum256(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// contentEqual compares two file content while ignoring the difference
+// in line endings, as sops always writes LF line endings
+func contentEqual(a []byte, b []byte) bool {
+	a = bytes.ReplaceAll(a, []byte("\r\n"), []byte("\n"))
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.Equal(a, b)
+}
@@ -0,0 +1,278 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/AlstonChan/composectl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// The comment written at the top of the team manifest
+const teamManifestHeader = `# The members of the team and the services whose secrets they can decrypt.
+# Managed by 'composectl team add' and 'composectl team remove'.
+`
+
+// TeamManifest is the committed team manifest of the repository, e.g.
+//
+//	members:
+//	  - name: alice
+//	    public_key: age1...
+//	    services:
+//	      - gitea
+//	      - monitoring-*
+type TeamManifest struct {
+	Path    string       `yaml:"-"`
+	Members []TeamMember `yaml:"members"`
+}
+
+// TeamMember is a member of the team and the services they can decrypt
+type TeamMember struct {
+	Name string `yaml:"name"`
+	// The age or SSH public key of the member
+	PublicKey string `yaml:"public_key"`
+	// The service names or globs over the service names
+	Services []string `yaml:"services"`
+}
+
+// LoadTeamManifest loads the team manifest of the repository. An empty
+// manifest is returned when the repository doesn't have one, so that
+// members can be added to it.
+func LoadTeamManifest(repoRoot string) (*TeamManifest, error) {
+	var manifestPath string = filepath.Join(repoRoot, config.TeamManifestFile)
+
+	content, err := os.ReadFile(manifestPath)
+	if os.IsNotExist(err) {
+		return &TeamManifest{Path: manifestPath}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", manifestPath, err)
+	}
+
+	var manifest TeamManifest
+	if err := yaml.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", manifestPath, err)
+	}
+	manifest.Path = manifestPath
+
+	for index, member := range manifest.Members {
+		if err := ValidateAgeRecipient(member.PublicKey); err != nil {
+			return nil, fmt.Errorf("invalid public key of %s in %s: %v", member.Name, manifestPath, err)
+		}
+		manifest.Members[index].PublicKey = NormalizeAgeRecipient(member.PublicKey)
+
+		for _, service := range member.Services {
+			if _, err := path.Match(service, ""); err != nil || service == "" {
+				return nil, fmt.Errorf("invalid service %q of %s in %s", service, member.Name, manifestPath)
+			}
+		}
+	}
+
+	return &manifest, nil
+}
+
+// Save writes the team manifest back to the repository
+func (m *TeamManifest) Save() error {
+	content, err := yaml.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("unable to serialize the team manifest: %v", err)
+	}
+
+	return writeFileAtomic(m.Path, append([]byte(teamManifestHeader), content...))
+}
+
+// Member returns the member with the given name, or nil
+func (m *TeamManifest) Member(name string) *TeamMember {
+	if m == nil {
+		return nil
+	}
+
+	for index := range m.Members {
+		if m.Members[index].Name == name {
+			return &m.Members[index]
+		}
+	}
+	return nil
+}
+
+// SetMember adds the member, or replaces the member with the same name
+func (m *TeamManifest) SetMember(member TeamMember) {
+	if existing := m.Member(member.Name); existing != nil {
+		*existing = member
+		return
+	}
+	m.Members = append(m.Members, member)
+}
+
+// RemoveMember removes the member with the given name, and reports
+// whether the member was found
+func (m *TeamManifest) RemoveMember(name string) bool {
+	var count int = len(m.Members)
+	m.Members = slices.DeleteFunc(m.Members, func(member TeamMember) bool {
+		return member.Name == name
+	})
+	return len(m.Members) != count
+}
+
+// RecipientsFor returns the public keys of the members that can decrypt
+// the secrets of the service
+func (m *TeamManifest) RecipientsFor(name string) []string {
+	if m == nil {
+		return nil
+	}
+
+	var recipients []string
+	for _, member := range m.Members {
+		if member.CanAccess(name) && !slices.Contains(recipients, member.PublicKey) {
+			recipients = append(recipients, member.PublicKey)
+		}
+	}
+	return recipients
+}
+
+// CanAccess reports whether the service is one of the member's services
+func (m TeamMember) CanAccess(name string) bool {
+	for _, service := range m.Services {
+		if matched, _ := path.Match(service, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchServices returns the services matching the service names or globs.
+// Every pattern must match at least one of the services.
+func MatchServices(serviceNames []string, patterns []string) ([]string, error) {
+	var matches []string
+	for _, pattern := range patterns {
+		var found bool = false
+		for _, name := range serviceNames {
+			matched, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid service pattern %q: %v", pattern, err)
+			}
+			if matched {
+				found = true
+				if !slices.Contains(matches, name) {
+					matches = append(matches, name)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no service matches %q", pattern)
+		}
+	}
+	return matches, nil
+}
+
+// PlanTeamRekey plans adding the public key to the encrypted files of the
+// addServices that aren't encrypted to it yet, and removing it from the
+// encrypted files of the removeServices that are. The other files are
+// left untouched.
+func PlanTeamRekey(repoRoot string, publicKey string, addServices []string, removeServices []string) ([]RekeyPlan, error) {
+	var plans []RekeyPlan
+	for _, name := range append(slices.Clone(addServices), removeServices...) {
+		var adding bool = slices.Contains(addServices, name)
+
+		files, err := ResolveServiceFiles(repoRoot, name, true)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving service's details: %v", err)
+		}
+
+		for _, file := range files {
+			var encryptedFilePath string = filepath.Join(repoRoot, config.DockerServicesDir, name, file.Filename)
+
+			metadata, err := ReadSopsMetadata(encryptedFilePath)
+			if err != nil {
+				return nil, err
+			}
+
+			var plan RekeyPlan = RekeyPlan{Service: name, File: file}
+			var hasKey bool = slices.Contains(metadata.AgeRecipients, publicKey)
+			if adding && !hasKey {
+				plan.Recipients = append(slices.Clone(metadata.AgeRecipients), publicKey)
+				plan.AddRecipients = []string{publicKey}
+			} else if !adding && hasKey {
+				plan.Recipients = slices.DeleteFunc(slices.Clone(metadata.AgeRecipients), func(recipient string) bool {
+					return recipient == publicKey
+				})
+				plan.RemoveRecipients = []string{publicKey}
+			} else {
+				continue
+			}
+
+			plans = append(plans, plan)
+		}
+	}
+
+	return plans, nil
+}
+
+// TeamChangeSummary returns a markdown summary of a team change, suitable
+// for the description of the pull request that commits it
+func TeamChangeSummary(title string, member TeamMember, plans []RekeyPlan, failed []string) string {
+	var summary bytes.Buffer
+	fmt.Fprintf(&summary, "## %s\n\n", title)
+	fmt.Fprintf(&summary, "- Member: %s\n", member.Name)
+	fmt.Fprintf(&summary, "- Public key: `%s`\n", member.PublicKey)
+	if len(member.Services) > 0 {
+		fmt.Fprintf(&summary, "- Services: %s\n", joinCode(member.Services))
+	}
+
+	fmt.Fprintf(&summary, "\n### Re-encrypted secrets (%d)\n\n", len(plans)-len(failed))
+	if len(plans) == len(failed) {
+		summary.WriteString("No secrets were re-encrypted.\n")
+	}
+	for _, plan := range plans {
+		var file string = path.Join(config.DockerServicesDir, plan.Service, plan.File.Filename)
+		if slices.Contains(failed, file) {
+			continue
+		}
+
+		var change string = "added"
+		if len(plan.RemoveRecipients) > 0 {
+			change = "removed"
+		}
+		fmt.Fprintf(&summary, "- `%s` (%s)\n", file, change)
+	}
+
+	if len(failed) > 0 {
+		fmt.Fprintf(&summary, "\n### Failed (%d)\n\n", len(failed))
+		for _, file := range failed {
+			fmt.Fprintf(&summary, "- `%s`\n", file)
+		}
+	}
+
+	return summary.String()
+}
+
+func joinCode(values []string) string {
+	var buffer bytes.Buffer
+	for index, value := range values {
+		if index > 0 {
+			buffer.WriteString(", ")
+		}
+		fmt.Fprintf(&buffer, "`%s`", value)
+	}
+	return buffer.String()
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// The suffix of the dotenv templates, e.g. ".env.example"
+const TemplateSuffix = ".example"
+
+// The named character sets of GenerateSecretValue
+var secretCharsets = map[string]string{
+	"alnum":   "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"hex":     "0123456789abcdef",
+	"urlsafe": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+	// The values aren't base64 encoded, base64 is the same alphabet as urlsafe
+	"base64": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+}
+
+// GenerateEnvTemplate returns a dotenv template with the keys of the sops
+// encrypted dotenv file and every value removed. The key names of a sops
+// encrypted dotenv file are in plaintext, so no private key is needed.
+func GenerateEnvTemplate(encryptedFilePath string) ([]byte, error) {
+	content, err := os.ReadFile(encryptedFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", encryptedFilePath, err)
+	}
+
+	var template bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, _, ok := parseDotenvLine(scanner.Text())
+		if !ok || strings.HasPrefix(key, "sops_") {
+			continue
+		}
+		template.WriteString(key + "=\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", encryptedFilePath, err)
+	}
+
+	if template.Len() == 0 {
+		return nil, fmt.Errorf("no keys found in %s", encryptedFilePath)
+	}
+
+	return template.Bytes(), nil
+}
+
+// GenerateSecretValue returns a random value of the given length drawn
+// from a named character set (alnum, hex or urlsafe, the url safe base64
+// alphabet also named base64) or from the given characters, which may be
+// any unicode
+func GenerateSecretValue(length int, charset string) (string, error) {
+	if length <= 0 {
+		return "", fmt.Errorf("the length of a generated secret must be positive")
+	}
+
+	var characters []rune = []rune(charset)
+	if named, ok := secretCharsets[charset]; ok {
+		characters = []rune(named)
+	}
+	if len(characters) < 2 {
+		return "", fmt.Errorf("the charset %q must be alnum, hex, urlsafe or at least two characters", charset)
+	}
+
+	var max *big.Int = big.NewInt(int64(len(characters)))
+	var value []rune = make([]rune, length)
+	for index := range value {
+		// rand.Int is uniform, unlike a modulo of a random byte
+		position, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("unable to generate a random value: %v", err)
+		}
+		value[index] = characters[position.Int64()]
+	}
+
+	return string(value), nil
+}
+
+// FillEnvTemplate returns the dotenv template with every empty value
+// replaced by a generated secret, and the keys that were generated. The
+// comments and the values that are already set are kept as they are.
+// A generated value with characters other than the urlsafe alphabet is
+// single quoted, so a custom charset can't contain a single quote.
+func FillEnvTemplate(template []byte, length int, charset string) ([]byte, []string, error) {
+	if _, ok := secretCharsets[charset]; !ok && strings.ContainsAny(charset, "'\r\n") {
+		return nil, nil, fmt.Errorf("the charset of a dotenv value can't contain a single quote or a line break")
+	}
+
+	var filled bytes.Buffer
+	var generated []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(template))
+	for scanner.Scan() {
+		var line string = scanner.Text()
+
+		key, value, ok := parseDotenvLine(line)
+		if !ok || value != "" {
+			filled.WriteString(line + "\n")
+			continue
+		}
+
+		secret, err := GenerateSecretValue(length, charset)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Keep everything before the "=", such as an "export " prefix
+		before, _, _ := strings.Cut(line, "=")
+		filled.WriteString(before + "=" + quoteDotenvValue(secret) + "\n")
+		generated = append(generated, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return filled.Bytes(), generated, nil
+}
+
+// quoteDotenvValue single quotes a value unless it only has characters of
+// the urlsafe alphabet, as a space, "#", "$" or a double quote would be
+// read differently by docker compose when the value is not quoted.
+func quoteDotenvValue(value string) string {
+	if strings.Trim(value, secretCharsets["urlsafe"]) == "" {
+		return value
+	}
+	return "'" + value + "'"
+}
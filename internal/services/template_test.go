@@ -0,0 +1,156 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestGenerateSecretValue(t *testing.T) {
+	var tests = []struct {
+		charset    string
+		length     int
+		characters string
+	}{
+		{"alnum", 32, secretCharsets["alnum"]},
+		{"hex", 64, "0123456789abcdef"},
+		{"urlsafe", 16, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"},
+		{"base64", 16, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"},
+		{"ab", 8, "ab"},
+		{"äöü€", 8, "äöü€"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.charset, func(t *testing.T) {
+			value, err := GenerateSecretValue(test.length, test.charset)
+			if err != nil {
+				t.Fatalf("GenerateSecretValue() error = %v", err)
+			}
+			if utf8.RuneCountInString(value) != test.length {
+				t.Errorf("GenerateSecretValue() = %q, want %d characters", value, test.length)
+			}
+			for _, char := range value {
+				if !strings.ContainsRune(test.characters, char) {
+					t.Errorf("GenerateSecretValue() = %q, %q is not in the charset", value, char)
+				}
+			}
+		})
+	}
+
+	var invalid = []struct {
+		name    string
+		length  int
+		charset string
+	}{
+		{"zero length", 0, "alnum"},
+		{"negative length", -1, "alnum"},
+		{"single character", 8, "a"},
+		{"empty charset", 8, ""},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := GenerateSecretValue(test.length, test.charset); err == nil {
+				t.Errorf("GenerateSecretValue(%d, %q) succeeded, want an error", test.length, test.charset)
+			}
+		})
+	}
+}
+
+func TestFillEnvTemplate(t *testing.T) {
+	var template string = "# database\nDB_USER=gitea\nDB_PASSWORD=\nexport API_TOKEN=\nEMPTY_QUOTED=\"\"\n\nNOT_A_KEY\n"
+
+	filled, generated, err := FillEnvTemplate([]byte(template), 12, "hex")
+	if err != nil {
+		t.Fatalf("FillEnvTemplate() error = %v", err)
+	}
+
+	if want := []string{"DB_PASSWORD", "API_TOKEN", "EMPTY_QUOTED"}; !slices.Equal(generated, want) {
+		t.Errorf("FillEnvTemplate() generated = %q, want %q", generated, want)
+	}
+
+	var lines []string = strings.Split(strings.TrimSuffix(string(filled), "\n"), "\n")
+	var wantPrefixes []string = []string{"# database", "DB_USER=gitea", "DB_PASSWORD=", "export API_TOKEN=",
+		"EMPTY_QUOTED=", "", "NOT_A_KEY"}
+	if len(lines) != len(wantPrefixes) {
+		t.Fatalf("FillEnvTemplate() = %q, want %d lines", filled, len(wantPrefixes))
+	}
+	for index, prefix := range wantPrefixes {
+		if !strings.HasPrefix(lines[index], prefix) {
+			t.Errorf("FillEnvTemplate() line %d = %q, want the prefix %q", index+1, lines[index], prefix)
+		}
+	}
+
+	// The generated values replace the empty ones
+	for _, line := range lines {
+		key, value, ok := parseDotenvLine(line)
+		if ok && slices.Contains(generated, key) && len(value) != 12 {
+			t.Errorf("FillEnvTemplate() %s = %q, want a generated value of 12 characters", key, value)
+		}
+	}
+
+	if _, _, err := FillEnvTemplate([]byte("KEY=\n"), 0, "hex"); err == nil {
+		t.Errorf("FillEnvTemplate() with a zero length, want an error")
+	}
+
+	// A value that docker compose would read differently is single quoted
+	filled, _, err = FillEnvTemplate([]byte("KEY=\n"), 16, "# $\"")
+	if err != nil {
+		t.Fatalf("FillEnvTemplate() error = %v", err)
+	}
+	if line := strings.TrimSuffix(string(filled), "\n"); !strings.HasPrefix(line, "KEY='") || !strings.HasSuffix(line, "'") {
+		t.Errorf("FillEnvTemplate() = %q, want a single quoted value", filled)
+	}
+	if _, value, _ := parseDotenvLine(string(filled)); utf8.RuneCountInString(value) != 16 {
+		t.Errorf("FillEnvTemplate() KEY = %q, want a generated value of 16 characters", value)
+	}
+
+	for _, charset := range []string{"ab'", "ab\n"} {
+		if _, _, err := FillEnvTemplate([]byte("KEY=\n"), 16, charset); err == nil {
+			t.Errorf("FillEnvTemplate() with the charset %q, want an error", charset)
+		}
+	}
+}
+
+func TestGenerateEnvTemplate(t *testing.T) {
+	var encryptedFilePath string = filepath.Join(t.TempDir(), ".env.enc")
+	var content string = "DB_USER=ENC[AES256_GCM,data:abc,type:str]\n#ENC[AES256_GCM,data:comment,type:comment]\n" +
+		"DB_PASSWORD=ENC[AES256_GCM,data:def,type:str]\nsops_version=3.9.0\nsops_mac=ENC[AES256_GCM,data:mac]\n"
+	if err := os.WriteFile(encryptedFilePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := GenerateEnvTemplate(encryptedFilePath)
+	if err != nil {
+		t.Fatalf("GenerateEnvTemplate() error = %v", err)
+	}
+	if want := "DB_USER=\nDB_PASSWORD=\n"; string(template) != want {
+		t.Errorf("GenerateEnvTemplate() = %q, want %q", template, want)
+	}
+
+	var metadataOnly string = filepath.Join(t.TempDir(), ".env.enc")
+	if err := os.WriteFile(metadataOnly, []byte("sops_version=3.9.0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateEnvTemplate(metadataOnly); err == nil {
+		t.Errorf("GenerateEnvTemplate() without keys, want an error")
+	}
+}
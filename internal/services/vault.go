@@ -0,0 +1,155 @@
+/*
+Copyright © 2025 Chan Alston git@chanalston.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The environment variables read by sops and the vault CLI
+const (
+	VaultAddrEnv  = "VAULT_ADDR"
+	VaultTokenEnv = "VAULT_TOKEN"
+)
+
+// The token sources of VaultConfig.TokenSource
+const (
+	// The VAULT_TOKEN environment variable, then the ~/.vault-token file
+	// written by 'vault login'. This is the default.
+	VaultTokenSourceEnv = "env"
+	// The prefix of a file containing the token, e.g. "file:/run/secrets/vault-token"
+	VaultTokenSourceFilePrefix = "file:"
+)
+
+// VaultConfig is the HashiCorp Vault server and transit key that sops
+// encrypts the data key with, in addition to the age recipients
+type VaultConfig struct {
+	// The address of the Vault server, e.g. http://127.0.0.1:8200
+	Address string
+	// Where to read the Vault token from, "env" or "file:<path>"
+	TokenSource string
+	// The transit key, either relative to the server such as
+	// "transit/keys/sops", or the full URI of the key
+	KeyPath string
+}
+
+// ResolveVaultTransitUri returns the full URI of the transit key that sops
+// expects for --hc-vault-transit, e.g.
+// "http://127.0.0.1:8200/v1/transit/keys/sops". A key relative to the
+// server, with or without the "v1/" prefix, is resolved against the address.
+func ResolveVaultTransitUri(address string, keyPath string) (string, error) {
+	keyPath = strings.TrimSpace(keyPath)
+	if keyPath == "" {
+		return "", fmt.Errorf("the Vault transit key is empty")
+	}
+
+	var uri string = keyPath
+	if !strings.Contains(keyPath, "://") {
+		if address == "" {
+			return "", fmt.Errorf("the Vault address is required to resolve the transit key %s", keyPath)
+		}
+		var relativePath string = strings.TrimPrefix(strings.TrimPrefix(keyPath, "/"), "v1/")
+		uri = strings.TrimSuffix(address, "/") + "/v1/" + relativePath
+	}
+
+	if err := ValidateVaultTransitUri(uri); err != nil {
+		return "", err
+	}
+	return uri, nil
+}
+
+// ValidateVaultTransitUri checks that the URI is in the format sops
+// expects, e.g. "https://vault.example.com:8200/v1/transit/keys/sops"
+func ValidateVaultTransitUri(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid Vault transit key %q: %v", uri, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid Vault transit key %q, expected an http or https URI", uri)
+	}
+
+	enginePath, keyName, found := strings.Cut(strings.TrimPrefix(parsed.Path, "/v1/"), "/keys/")
+	if !strings.HasPrefix(parsed.Path, "/v1/") || !found || enginePath == "" || keyName == "" || strings.Contains(keyName, "/") {
+		return fmt.Errorf("invalid Vault transit key %q, expected the path /v1/<engine>/keys/<key>", uri)
+	}
+
+	return nil
+}
+
+// ResolveToken returns the Vault token from the configured token source
+func (c VaultConfig) ResolveToken() (string, error) {
+	switch {
+	case c.TokenSource == "" || c.TokenSource == VaultTokenSourceEnv:
+		if token := os.Getenv(VaultTokenEnv); token != "" {
+			return token, nil
+		}
+
+		userDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("%s is not set and the $HOME directory is unknown", VaultTokenEnv)
+		}
+		content, err := os.ReadFile(filepath.Join(userDir, ".vault-token"))
+		if err != nil {
+			return "", fmt.Errorf("%s is not set and ~/.vault-token can't be read, run 'vault login'", VaultTokenEnv)
+		}
+		return strings.TrimSpace(string(content)), nil
+	case strings.HasPrefix(c.TokenSource, VaultTokenSourceFilePrefix):
+		var tokenPath string = strings.TrimPrefix(c.TokenSource, VaultTokenSourceFilePrefix)
+		content, err := os.ReadFile(tokenPath)
+		if err != nil {
+			return "", fmt.Errorf("unable to read the Vault token: %v", err)
+		}
+
+		var token string = strings.TrimSpace(string(content))
+		if token == "" {
+			return "", fmt.Errorf("the Vault token file %s is empty", tokenPath)
+		}
+		return token, nil
+	default:
+		return "", fmt.Errorf("unknown Vault token source %q, expected %q or %q", c.TokenSource,
+			VaultTokenSourceEnv, VaultTokenSourceFilePrefix+"<path>")
+	}
+}
+
+// ExportVaultEnv sets VAULT_ADDR and VAULT_TOKEN from the config for the
+// sops processes started by composectl. The variables already set in the
+// environment are kept, and nothing is done when no address is configured.
+func ExportVaultEnv(vaultConfig VaultConfig) error {
+	if vaultConfig.Address == "" {
+		return nil
+	}
+
+	if os.Getenv(VaultAddrEnv) == "" {
+		os.Setenv(VaultAddrEnv, vaultConfig.Address)
+	}
+
+	// sops reads the ~/.vault-token file by itself
+	if os.Getenv(VaultTokenEnv) == "" && strings.HasPrefix(vaultConfig.TokenSource, VaultTokenSourceFilePrefix) {
+		token, err := vaultConfig.ResolveToken()
+		if err != nil {
+			return err
+		}
+		os.Setenv(VaultTokenEnv, token)
+	}
+
+	return nil
+}